@@ -1,6 +1,7 @@
 package binarize
 
 import (
+	"bufio"
 	"fmt"
 	"image"
 	"image/color"
@@ -10,6 +11,8 @@ import (
 	"log"
 	"math"
 	"os"
+	"path"
+	"strings"
 	"sync"
 
 	"github.com/piggynl/subtitle/config"
@@ -30,11 +33,6 @@ const (
 	whiteValue = 255
 )
 
-var (
-	black = color.Gray{blackValue}
-	white = color.Gray{whiteValue}
-)
-
 var CoordPool = sync.Pool{
 	New: func() interface{} {
 		return []Coordinate{}
@@ -55,15 +53,70 @@ func max(x, y int) int {
 	return y
 }
 
+var Formats = []string{"jpg", "png", "ppm", "pgm"}
+
+func CheckFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported image format %q, available: %s", format, strings.Join(Formats, ", "))
+}
+
+var Regions []config.Region
+
 func Init() {
-	switch config.Value.Binarize.Optitmizer.Connectivity {
-	case 8:
+	if err := CheckFormat(config.Value.Ocr.Format); err != nil {
+		log.Fatalf("invalid ocr.format: %s", err.Error())
+	}
+	switch config.Value.Ocr.Image.Resample {
+	case "nearest", "bilinear", "area":
+		// no-op
+	default:
+		log.Fatalf("unsupported resampling method %q", config.Value.Ocr.Image.Resample)
+	}
+	switch config.Value.Ocr.Image.Polarity {
+	case "dark", "light":
 		// no-op
-	case 4:
-		directions = directions[0:4]
 	default:
-		log.Fatalf("unsupported pixel connectivity: %d", config.Value.Binarize.Optitmizer.Connectivity)
+		log.Fatalf("unsupported ocr image polarity %q", config.Value.Ocr.Image.Polarity)
 	}
+	regions, err := config.Value.Binarize.Resolve()
+	if err != nil {
+		log.Fatalf("invalid binarize.regions: %s", err.Error())
+	}
+	for _, r := range regions {
+		if err := check(&r.BinarizeConfig); err != nil {
+			if r.Name != "" {
+				log.Fatalf("region %q: %s", r.Name, err.Error())
+			}
+			log.Fatal(err)
+		}
+	}
+	Regions = regions
+}
+
+func check(cfg *config.BinarizeConfig) error {
+	switch cfg.Mode {
+	case "colors", "otsu", "niblack", "sauvola", "outline":
+		// no-op
+	default:
+		return fmt.Errorf("unsupported binarize mode %q", cfg.Mode)
+	}
+	switch cfg.Threshold.Polarity {
+	case "light", "dark":
+		// no-op
+	default:
+		return fmt.Errorf("unsupported text polarity %q", cfg.Threshold.Polarity)
+	}
+	switch cfg.Optitmizer.Connectivity {
+	case 4, 8:
+		// no-op
+	default:
+		return fmt.Errorf("unsupported pixel connectivity: %d", cfg.Optitmizer.Connectivity)
+	}
+	return nil
 }
 
 func Load(name string) (image.Image, error) {
@@ -71,7 +124,13 @@ func Load(name string) (image.Image, error) {
 	if err != nil {
 		return nil, err
 	}
-	img, _, err := image.Decode(file)
+	var img image.Image
+	switch path.Ext(name) {
+	case ".ppm", ".pgm":
+		img, err = DecodePNM(bufio.NewReaderSize(file, 1<<20))
+	default:
+		img, _, err = image.Decode(file)
+	}
 	if err != nil {
 		log.Print(err)
 	}
@@ -79,7 +138,7 @@ func Load(name string) (image.Image, error) {
 		return nil, err
 	}
 	file.Close()
-	return img, nil
+	return Place(img), nil
 }
 
 func Encode(w io.Writer, img image.Image, format string, jpgQuality int) error {
@@ -88,9 +147,10 @@ func Encode(w io.Writer, img image.Image, format string, jpgQuality int) error {
 		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpgQuality})
 	case "png":
 		return png.Encode(w, img)
+	case "ppm", "pgm":
+		return EncodePNM(w, img, format)
 	default:
-		log.Fatalf("unsupported image format %q", config.Value.Slice.Format)
-		panic(nil) // unreachable
+		return CheckFormat(format)
 	}
 }
 
@@ -106,59 +166,87 @@ func Save(name string, img image.Image, format string, jpgQuality int) error {
 	return nil
 }
 
-func Crop(img SubImager) image.Image {
-	b := img.Bounds()
-	return img.SubImage(image.Rectangle{
+func CropRect(b image.Rectangle, cfg *config.BinarizeConfig) image.Rectangle {
+	return image.Rectangle{
 		Min: image.Point{
-			X: b.Min.X + config.Value.Binarize.Crop.Left.Calculate(b.Dx()),
-			Y: b.Min.Y + config.Value.Binarize.Crop.Top.Calculate(b.Dy()),
+			X: b.Min.X + cfg.Crop.Left.Calculate(b.Dx()),
+			Y: b.Min.Y + cfg.Crop.Top.Calculate(b.Dy()),
 		},
 		Max: image.Point{
-			X: b.Min.X + config.Value.Binarize.Crop.Right.Calculate(b.Dx()),
-			Y: b.Min.Y + config.Value.Binarize.Crop.Bottom.Calculate(b.Dy()),
+			X: b.Min.X + cfg.Crop.Right.Calculate(b.Dx()),
+			Y: b.Min.Y + cfg.Crop.Bottom.Calculate(b.Dy()),
 		},
-	})
+	}
+}
+
+// CropUnion covers the crop areas of all regions
+func CropUnion(b image.Rectangle, regions []config.Region) image.Rectangle {
+	r := image.Rectangle{}
+	for i := range regions {
+		r = r.Union(CropRect(b, &regions[i].BinarizeConfig))
+	}
+	return r
+}
+
+func Crop(img SubImager, cfg *config.BinarizeConfig) image.Image {
+	return img.SubImage(CropRect(img.Bounds(), cfg))
 }
 
-func Binarize(img image.Image) (*image.Gray, []Coordinate) {
+func Binarize(img image.Image, cfg *config.BinarizeConfig) (*image.Gray, []Coordinate) {
+	if cfg.Mode != "colors" {
+		return binarizeThreshold(img, cfg)
+	}
 	b := img.Bounds()
-	imgNew := image.NewGray(b)
+	imgNew := newGray(b)
 	index := CoordPool.Get().([]Coordinate)[:0]
-	for x := b.Min.X; x < b.Max.X; x++ {
-		for y := b.Min.Y; y < b.Max.Y; y++ {
+	row := rowPool.Get().([]color.RGBA)
+	if cap(row) < b.Dx() {
+		row = make([]color.RGBA, b.Dx())
+	}
+	row = row[:b.Dx()]
+	textColors := cfg.TextColors
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		readRow(img, y, b.Min.X, row)
+		pix := imgNew.Pix[imgNew.PixOffset(b.Min.X, y):]
+		for i, tcol := range row {
 			matched := false
-			tcol := rgb(img.At(x, y))
-			for _, cg := range config.Value.Binarize.TextColors {
-				if cg.Contains(tcol) {
+			for j := range textColors {
+				if textColors[j].Contains(tcol) {
 					matched = true
 					break
 				}
 			}
 			if matched {
-				imgNew.SetGray(x, y, black)
-				index = append(index, Coordinate{x, y})
+				pix[i] = blackValue
+				index = append(index, Coordinate{b.Min.X + i, y})
 			} else {
-				imgNew.SetGray(x, y, white)
+				pix[i] = whiteValue
 			}
 		}
 	}
+	rowPool.Put(row)
 	return imgNew, index
 }
 
-func Optimize(source image.Image, img *image.Gray, index []Coordinate) (*image.Gray, []Coordinate) {
+func Optimize(source image.Image, img *image.Gray, index []Coordinate, cfg *config.BinarizeConfig) (*image.Gray, []Coordinate) {
+	opt := &cfg.Optitmizer
 	bound := img.Bounds()
-	minS := config.Value.Binarize.Optitmizer.Size.Min.Calculate(bound.Dx() * bound.Dy())
-	maxS := config.Value.Binarize.Optitmizer.Size.Max.Calculate(bound.Dx() * bound.Dy())
-	minW := config.Value.Binarize.Optitmizer.Width.Min.Calculate(bound.Dx())
-	maxW := config.Value.Binarize.Optitmizer.Width.Max.Calculate(bound.Dx())
-	minH := config.Value.Binarize.Optitmizer.Height.Min.Calculate(bound.Dy())
-	maxH := config.Value.Binarize.Optitmizer.Height.Max.Calculate(bound.Dy())
-	imgNew := image.NewGray(bound)
-	for x := bound.Min.X; x < bound.Max.X; x++ {
-		for y := bound.Min.Y; y < bound.Max.Y; y++ {
-			imgNew.SetGray(x, y, white)
-		}
+	minS := opt.Size.Min.Calculate(bound.Dx() * bound.Dy())
+	maxS := opt.Size.Max.Calculate(bound.Dx() * bound.Dy())
+	minW := opt.Width.Min.Calculate(bound.Dx())
+	maxW := opt.Width.Max.Calculate(bound.Dx())
+	minH := opt.Height.Min.Calculate(bound.Dy())
+	maxH := opt.Height.Max.Calculate(bound.Dy())
+	minSW := float64(opt.Stroke.Width.Min.Calculate(bound.Dy()))
+	maxSW := float64(opt.Stroke.Width.Max.Calculate(bound.Dy()))
+	checkStroke := opt.Stroke.Variation > 0 || !opt.Stroke.Width.Min.Equal(0, 0) || !opt.Stroke.Width.Max.Equal(1, 0)
+	checkSolidity := opt.Solidity.Min > 0 || opt.Solidity.Max < 1
+	var dist []int
+	imgNew := newGray(bound)
+	for i := range imgNew.Pix {
+		imgNew.Pix[i] = whiteValue
 	}
+	borderColors := opt.Border.Color
 	indexNew := CoordPool.Get().([]Coordinate)[:0]
 	subindex := CoordPool.Get().([]Coordinate)[:0]
 	length := bound.Dx() * bound.Dy()
@@ -186,10 +274,10 @@ func Optimize(source image.Image, img *image.Gray, index []Coordinate) (*image.G
 				subindex = append(subindex, Coordinate{x, y})
 			}
 			onBorder := func(x, y int) {
-				tcol := rgb(source.At(x, y))
+				tcol := rgbAt(source, x, y)
 				matched := false
-				for _, cg := range config.Value.Binarize.Optitmizer.Border.Color {
-					if cg.Contains(tcol) {
+				for i := range borderColors {
+					if borderColors[i].Contains(tcol) {
 						matched = true
 						break
 					}
@@ -199,22 +287,29 @@ func Optimize(source image.Image, img *image.Gray, index []Coordinate) (*image.G
 					b++
 				}
 			}
-			bfs(img, visited, c, callback, onBorder)
-			minB := config.Value.Binarize.Optitmizer.Border.Level.Calculate(bTotal)
+			bfs(img, visited, c, directions[:opt.Connectivity], callback, onBorder)
+			minB := opt.Border.Level.Calculate(bTotal)
 			w := maxX - minX + 1
 			h := maxY - minY + 1
 			discard := size < minS || size > maxS || w < minW || w > maxW || h < minH || h > maxH || b < minB
-			discard = discard || (config.Value.Binarize.Optitmizer.NoOnEdge.Left && minX == bound.Min.X)
-			discard = discard || (config.Value.Binarize.Optitmizer.NoOnEdge.Right && maxX == bound.Max.X-1)
-			discard = discard || (config.Value.Binarize.Optitmizer.NoOnEdge.Top && minY == bound.Min.Y)
-			discard = discard || (config.Value.Binarize.Optitmizer.NoOnEdge.Bottom && maxY == bound.Max.Y-1)
-			if discard {
-				for _, sc := range subindex {
-					imgNew.SetGray(sc.X, sc.Y, white)
-				}
-			} else {
+			discard = discard || (opt.NoOnEdge.Left && minX == bound.Min.X)
+			discard = discard || (opt.NoOnEdge.Right && maxX == bound.Max.X-1)
+			discard = discard || (opt.NoOnEdge.Top && minY == bound.Min.Y)
+			discard = discard || (opt.NoOnEdge.Bottom && maxY == bound.Max.Y-1)
+			discard = discard || !opt.AspectRatio.Contains(float64(w)/float64(h))
+			discard = discard || !opt.Density.Contains(float64(size)/float64(w*h))
+			box := image.Rect(minX, minY, maxX+1, maxY+1)
+			if !discard && checkSolidity {
+				discard = !opt.Solidity.Contains(solidity(subindex, box))
+			}
+			if !discard && checkStroke {
+				var width, variation float64
+				width, variation, dist = strokeWidth(subindex, box, dist)
+				discard = width < minSW || width > maxSW || (opt.Stroke.Variation > 0 && variation > opt.Stroke.Variation)
+			}
+			if !discard {
 				for _, sc := range subindex {
-					imgNew.SetGray(sc.X, sc.Y, black)
+					imgNew.Pix[imgNew.PixOffset(sc.X, sc.Y)] = blackValue
 				}
 				indexNew = append(indexNew, subindex...)
 			}
@@ -225,7 +320,7 @@ func Optimize(source image.Image, img *image.Gray, index []Coordinate) (*image.G
 	return imgNew, indexNew
 }
 
-func Trim(img *image.Gray, index []Coordinate) *image.Gray {
+func Bounds(index []Coordinate) image.Rectangle {
 	minX := math.MaxInt32
 	maxX := math.MinInt32
 	minY := math.MaxInt32
@@ -237,25 +332,64 @@ func Trim(img *image.Gray, index []Coordinate) *image.Gray {
 		maxY = max(maxY, c.Y)
 	}
 	if minX == math.MaxInt32 {
+		return image.Rectangle{}
+	}
+	return image.Rect(minX, minY, maxX+1, maxY+1)
+}
+
+func Trim(img *image.Gray, index []Coordinate) *image.Gray {
+	return TrimBox(img, Bounds(index))
+}
+
+func TrimBox(img *image.Gray, box image.Rectangle) *image.Gray {
+	if box.Empty() {
 		return nil
 	}
+	minX, maxX := box.Min.X, box.Max.X-1
+	minY, maxY := box.Min.Y, box.Max.Y-1
 	dx := config.Value.Ocr.Margin.X.Calculate(maxX - minX + 1)
 	dy := config.Value.Ocr.Margin.Y.Calculate(maxY - minY + 1)
 
 	b := img.Bounds()
-	imgNew := image.NewGray(image.Rect(minX-dx, minY-dy, maxX+dx+1, maxY+dy+1))
-	for x := minX - dx; x <= maxX+dx; x++ {
-		for y := minY - dy; y <= maxY+dy; y++ {
-			if (image.Point{x, y}).In(b) == false {
-				imgNew.SetGray(x, y, white)
-			} else {
-				imgNew.SetGray(x, y, img.GrayAt(x, y))
-			}
-		}
+	r := image.Rect(minX-dx, minY-dy, maxX+dx+1, maxY+dy+1)
+	imgNew := image.NewGray(r)
+	for i := range imgNew.Pix {
+		imgNew.Pix[i] = whiteValue
+	}
+	inner := box.Intersect(b)
+	for y := inner.Min.Y; y < inner.Max.Y; y++ {
+		copy(imgNew.Pix[imgNew.PixOffset(inner.Min.X, y):], img.Pix[img.PixOffset(inner.Min.X, y):img.PixOffset(inner.Max.X, y)])
 	}
 	return imgNew
 }
 
+type Extraction struct {
+	Image *image.Gray
+	Frame image.Rectangle
+	Crop  image.Rectangle
+	Text  image.Rectangle
+}
+
+func Extract(source image.Image, cfg *config.BinarizeConfig) Extraction {
+	morphology := cfg.Optitmizer.Morphology
+	cropped := Crop(source.(SubImager), cfg)
+	binaried, index1 := Binarize(cropped, cfg)
+	binaried, index1 = morph(binaried, index1, morphology.Before)
+	optimized, index2 := Optimize(cropped, binaried, index1, cfg)
+	optimized, index2 = morph(optimized, index2, morphology.After)
+	e := Extraction{
+		Image: Trim(optimized, index2),
+		Frame: source.Bounds(),
+		Crop:  cropped.Bounds(),
+		Text:  Bounds(index2),
+	}
+	CoordPool.Put(index1)
+	CoordPool.Put(index2)
+	recycle(binaried)
+	recycle(optimized)
+	return e
+}
+
 func Difference(img1, img2 *image.Gray) int {
 	if img1 == nil || img2 == nil {
 		return math.MaxInt32
@@ -307,7 +441,7 @@ var directions = []Coordinate{
 	{1, -1},
 }
 
-func bfs(img *image.Gray, vis []bool, start Coordinate, cb, onBorder func(x, y int)) {
+func bfs(img *image.Gray, vis []bool, start Coordinate, directions []Coordinate, cb, onBorder func(x, y int)) {
 	bound := img.Bounds()
 	q := []Coordinate{start}
 	vis[img.PixOffset(start.X, start.Y)/1] = true
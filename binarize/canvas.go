@@ -0,0 +1,50 @@
+package binarize
+
+import (
+	"image"
+	"image/color"
+)
+
+type Canvas struct {
+	image.Image
+	Offset image.Point
+	Frame  image.Rectangle
+}
+
+var placement *Canvas
+
+func SetCanvas(frame image.Rectangle, offset image.Point) {
+	placement = &Canvas{Offset: offset, Frame: frame}
+}
+
+func Place(img image.Image) image.Image {
+	if placement == nil {
+		return img
+	}
+	return &Canvas{
+		Image:  img,
+		Offset: placement.Offset.Sub(img.Bounds().Min),
+		Frame:  placement.Frame,
+	}
+}
+
+func (c *Canvas) Bounds() image.Rectangle {
+	return c.Frame
+}
+
+func (c *Canvas) At(x, y int) color.Color {
+	p := image.Point{x, y}.Sub(c.Offset)
+	if !p.In(c.Image.Bounds()) {
+		return color.Black
+	}
+	return c.Image.At(p.X, p.Y)
+}
+
+func (c *Canvas) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(c.Frame)
+	return &Canvas{
+		Image:  c.Image.(SubImager).SubImage(r.Sub(c.Offset)),
+		Offset: c.Offset,
+		Frame:  r,
+	}
+}
@@ -0,0 +1,139 @@
+package binarize
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// solidity is the ratio of pixels to the area of their convex hull, strokes
+// of glyphs are solid while textures matching the text colors are ragged
+func solidity(pixels []Coordinate, box image.Rectangle) float64 {
+	left := make([]int, box.Dy())
+	right := make([]int, box.Dy())
+	for i := range left {
+		left[i], right[i] = math.MaxInt32, math.MinInt32
+	}
+	for _, c := range pixels {
+		y := c.Y - box.Min.Y
+		left[y] = min(left[y], c.X)
+		right[y] = max(right[y], c.X+1)
+	}
+	points := make([]image.Point, 0, 4*box.Dy())
+	for i := range left {
+		if left[i] > right[i] {
+			continue
+		}
+		y := box.Min.Y + i
+		points = append(points,
+			image.Point{left[i], y}, image.Point{right[i], y},
+			image.Point{left[i], y + 1}, image.Point{right[i], y + 1},
+		)
+	}
+	area := hullArea(points)
+	if area == 0 {
+		return 1
+	}
+	return float64(len(pixels)) / area
+}
+
+func cross(o, a, b image.Point) int {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+// hullArea builds the convex hull with the monotone chain algorithm
+func hullArea(points []image.Point) float64 {
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].X != points[j].X {
+			return points[i].X < points[j].X
+		}
+		return points[i].Y < points[j].Y
+	})
+	hull := make([]image.Point, 0, len(points)+1)
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(points) - 2; i >= 0; i-- {
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], points[i]) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, points[i])
+	}
+	area := 0
+	for i := 0; i+1 < len(hull); i++ {
+		area += hull[i].X*hull[i+1].Y - hull[i+1].X*hull[i].Y
+	}
+	return math.Abs(float64(area)) / 2
+}
+
+// strokeWidth estimates the stroke width transform with a chamfer distance
+// transform, widths are read on the ridge where the distance to the
+// background peaks, and returned as their mean and coefficient of variation
+func strokeWidth(pixels []Coordinate, box image.Rectangle, dist []int) (float64, float64, []int) {
+	w, h := box.Dx()+2, box.Dy()+2
+	if cap(dist) < w*h {
+		dist = make([]int, w*h)
+	}
+	dist = dist[:w*h]
+	for i := range dist {
+		dist[i] = 0
+	}
+	const inf = math.MaxInt32 / 2
+	for _, c := range pixels {
+		dist[(c.Y-box.Min.Y+1)*w+c.X-box.Min.X+1] = inf
+	}
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			if dist[i] == 0 {
+				continue
+			}
+			d := min(dist[i-1]+3, dist[i-w]+3)
+			d = min(d, min(dist[i-w-1]+4, dist[i-w+1]+4))
+			dist[i] = min(dist[i], d)
+		}
+	}
+	for y := h - 2; y > 0; y-- {
+		for x := w - 2; x > 0; x-- {
+			i := y*w + x
+			if dist[i] == 0 {
+				continue
+			}
+			d := min(dist[i+1]+3, dist[i+w]+3)
+			d = min(d, min(dist[i+w+1]+4, dist[i+w-1]+4))
+			dist[i] = min(dist[i], d)
+		}
+	}
+	n, sum, sq := 0, 0.0, 0.0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			d := dist[i]
+			if d == 0 {
+				continue
+			}
+			ridge := true
+			for _, o := range directions {
+				if dist[i+o.Y*w+o.X] > d {
+					ridge = false
+					break
+				}
+			}
+			if ridge {
+				width := 2*float64(d)/3 - 1
+				n++
+				sum += width
+				sq += width * width
+			}
+		}
+	}
+	if n == 0 {
+		return 0, 0, dist
+	}
+	mean := sum / float64(n)
+	return mean, math.Sqrt(math.Max(sq/float64(n)-mean*mean, 0)) / mean, dist
+}
@@ -0,0 +1,83 @@
+package binarize
+
+import (
+	"image"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+type segment struct {
+	y0, y1 int
+}
+
+// Lines splits text into lines with the horizontal projection profile, rows
+// without text at least gap high separate lines, and segments lower than
+// minHeight such as accents or dots are joined to the nearest line, both
+// are relative to the height of the text
+func Lines(img *image.Gray, gapValue, minHeightValue config.RelativeValue) []image.Rectangle {
+	b := img.Bounds()
+	rows := make([]int, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(b.Min.X, y):]
+		for i := 0; i < b.Dx(); i++ {
+			if pix[i] == blackValue {
+				rows[y-b.Min.Y]++
+			}
+		}
+	}
+	first, last := -1, -1
+	for y, n := range rows {
+		if n > 0 {
+			if first < 0 {
+				first = y
+			}
+			last = y
+		}
+	}
+	gap := gapValue.Calculate(last - first + 1)
+	minHeight := minHeightValue.Calculate(last - first + 1)
+	segs := []segment{}
+	for y, n := range rows {
+		if n == 0 {
+			continue
+		}
+		if l := len(segs) - 1; l >= 0 && y-segs[l].y1 < gap {
+			segs[l].y1 = y + 1
+		} else {
+			segs = append(segs, segment{y, y + 1})
+		}
+	}
+	for len(segs) > 1 {
+		short := -1
+		for i, s := range segs {
+			if s.y1-s.y0 < minHeight && (short < 0 || s.y1-s.y0 < segs[short].y1-segs[short].y0) {
+				short = i
+			}
+		}
+		if short < 0 {
+			break
+		}
+		into := short - 1
+		if short == 0 || (short+1 < len(segs) && segs[short+1].y0-segs[short].y1 < segs[short].y0-segs[short-1].y1) {
+			into = short + 1
+		}
+		segs[into].y0 = min(segs[into].y0, segs[short].y0)
+		segs[into].y1 = max(segs[into].y1, segs[short].y1)
+		segs = append(segs[:short], segs[short+1:]...)
+	}
+	lines := make([]image.Rectangle, 0, len(segs))
+	for _, s := range segs {
+		minX, maxX := b.Max.X, b.Min.X-1
+		for y := b.Min.Y + s.y0; y < b.Min.Y+s.y1; y++ {
+			pix := img.Pix[img.PixOffset(b.Min.X, y):]
+			for i := 0; i < b.Dx(); i++ {
+				if pix[i] == blackValue {
+					minX = min(minX, b.Min.X+i)
+					maxX = max(maxX, b.Min.X+i)
+				}
+			}
+		}
+		lines = append(lines, image.Rect(minX, b.Min.Y+s.y0, maxX+1, b.Min.Y+s.y1))
+	}
+	return lines
+}
@@ -0,0 +1,154 @@
+package binarize
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/util"
+)
+
+// Morph applies one operation on a mask, leaving the mask untouched
+func Morph(img *image.Gray, m config.Morphology) *image.Gray {
+	switch m.Op {
+	case "dilate":
+		return spread(img, m.Size, false)
+	case "erode":
+		return spread(img, m.Size, true)
+	case "open":
+		tmp := spread(img, m.Size, true)
+		defer recycle(tmp)
+		return spread(tmp, m.Size, false)
+	case "close":
+		tmp := spread(img, m.Size, false)
+		defer recycle(tmp)
+		return spread(tmp, m.Size, true)
+	case "fill":
+		return fill(img, m.Size)
+	default:
+		panic(fmt.Sprintf("unsupported morphology operation %q", m.Op))
+	}
+}
+
+func Index(img *image.Gray) []Coordinate {
+	b := img.Bounds()
+	index := CoordPool.Get().([]Coordinate)[:0]
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(b.Min.X, y):]
+		for i := 0; i < b.Dx(); i++ {
+			if pix[i] == blackValue {
+				index = append(index, Coordinate{b.Min.X + i, y})
+			}
+		}
+	}
+	return index
+}
+
+// morph consumes the mask and its index when there is anything to apply
+func morph(img *image.Gray, index []Coordinate, ops []config.Morphology) (*image.Gray, []Coordinate) {
+	if len(ops) == 0 {
+		return img, index
+	}
+	for _, op := range ops {
+		next := Morph(img, op)
+		recycle(img)
+		img = next
+	}
+	CoordPool.Put(index)
+	return img, Index(img)
+}
+
+// spread turns a pixel black if any (dilation) or all (erosion) of the
+// pixels within radius r are black, pixels outside the mask are ignored
+func spread(img *image.Gray, r int, all bool) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tmp := newGray(b)
+	defer recycle(tmp)
+	out := newGray(b)
+	src := img.Pix[img.PixOffset(b.Min.X, b.Min.Y):]
+	pass(src, img.Stride, 1, tmp.Pix, tmp.Stride, 1, h, w, r, all)
+	pass(tmp.Pix, 1, tmp.Stride, out.Pix, 1, out.Stride, w, h, r, all)
+	return out
+}
+
+func pass(src []uint8, srcLine, srcStep int, dst []uint8, dstLine, dstStep int, lines, n, r int, all bool) {
+	for l := 0; l < lines; l++ {
+		s, d := src[l*srcLine:], dst[l*dstLine:]
+		count := 0
+		for i := 0; i < min(r, n); i++ {
+			if s[i*srcStep] == blackValue {
+				count++
+			}
+		}
+		for i := 0; i < n; i++ {
+			if j := i + r; j < n && s[j*srcStep] == blackValue {
+				count++
+			}
+			if j := i - r - 1; j >= 0 && s[j*srcStep] == blackValue {
+				count--
+			}
+			black := count > 0
+			if all {
+				black = count == min(i+r, n-1)-max(i-r, 0)+1
+			}
+			if black {
+				d[i*dstStep] = blackValue
+			} else {
+				d[i*dstStep] = whiteValue
+			}
+		}
+	}
+}
+
+// fill turns white areas enclosed by black pixels into black, unless
+// they are larger than limit pixels, so that counters of glyphs are kept
+func fill(img *image.Gray, limit int) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := newGray(b)
+	for y := 0; y < h; y++ {
+		copy(out.Pix[y*out.Stride:y*out.Stride+w], img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):])
+	}
+	visited := util.BoolSlicePool.Get().([]bool)[:0]
+	if cap(visited) < w*h {
+		visited = make([]bool, w*h)
+	}
+	visited = visited[:w*h]
+	for i := range visited {
+		visited[i] = false
+	}
+	area := []int{}
+	for start := range out.Pix {
+		if visited[start] || out.Pix[start] == blackValue {
+			continue
+		}
+		area = append(area[:0], start)
+		visited[start] = true
+		enclosed := true
+		for k := 0; k < len(area); k++ {
+			x, y := area[k]%w, area[k]/w
+			if x == 0 || y == 0 || x == w-1 || y == h-1 {
+				enclosed = false
+			}
+			for _, d := range directions[:4] {
+				xx, yy := x+d.X, y+d.Y
+				if xx < 0 || yy < 0 || xx >= w || yy >= h {
+					continue
+				}
+				i := yy*w + xx
+				if !visited[i] && out.Pix[i] != blackValue {
+					visited[i] = true
+					area = append(area, i)
+				}
+			}
+		}
+		if enclosed && (limit == 0 || len(area) <= limit) {
+			for _, i := range area {
+				out.Pix[i] = blackValue
+			}
+		}
+	}
+	util.BoolSlicePool.Put(visited)
+	return out
+}
@@ -0,0 +1,107 @@
+package binarize
+
+import (
+	"image"
+	"image/color"
+	"sync"
+)
+
+var grayPool = sync.Pool{
+	New: func() interface{} {
+		return &image.Gray{}
+	},
+}
+
+var rowPool = sync.Pool{
+	New: func() interface{} {
+		return []color.RGBA{}
+	},
+}
+
+func newGray(r image.Rectangle) *image.Gray {
+	img := grayPool.Get().(*image.Gray)
+	n := r.Dx() * r.Dy()
+	if cap(img.Pix) < n {
+		img.Pix = make([]uint8, n)
+	}
+	img.Pix = img.Pix[:n]
+	img.Stride = r.Dx()
+	img.Rect = r
+	return img
+}
+
+func recycle(img *image.Gray) {
+	if img != nil {
+		grayPool.Put(img)
+	}
+}
+
+func readRow(img image.Image, y, x0 int, row []color.RGBA) {
+	switch img := img.(type) {
+	case *image.RGBA:
+		pix := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{R: pix[i*4], G: pix[i*4+1], B: pix[i*4+2]}
+		}
+	case *image.NRGBA:
+		pix := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			if pix[i*4+3] == 0xff {
+				row[i] = color.RGBA{R: pix[i*4], G: pix[i*4+1], B: pix[i*4+2]}
+				continue
+			}
+			r, g, b, _ := color.NRGBA{pix[i*4], pix[i*4+1], pix[i*4+2], pix[i*4+3]}.RGBA()
+			row[i] = color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8)}
+		}
+	case *image.YCbCr:
+		// pixels sharing chroma samples are next to each other in a row
+		hs := 1
+		switch img.SubsampleRatio {
+		case image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio420:
+			hs = 2
+		case image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410:
+			hs = 4
+		}
+		ys := img.Y[img.YOffset(x0, y):]
+		c0 := img.COffset(x0, y) - x0/hs
+		for i := range row {
+			ci := c0 + (x0+i)/hs
+			r, g, b := color.YCbCrToRGB(ys[i], img.Cb[ci], img.Cr[ci])
+			row[i] = color.RGBA{R: r, G: g, B: b}
+		}
+	case *image.Gray:
+		pix := img.Pix[img.PixOffset(x0, y):]
+		for i := range row {
+			row[i] = color.RGBA{R: pix[i], G: pix[i], B: pix[i]}
+		}
+	case *Canvas:
+		p := image.Point{x0, y}.Sub(img.Offset)
+		if (image.Rectangle{p, p.Add(image.Point{len(row), 1})}).In(img.Image.Bounds()) {
+			readRow(img.Image, p.Y, p.X, row)
+			return
+		}
+		for i := range row {
+			row[i] = rgb(img.At(x0+i, y))
+		}
+	default:
+		for i := range row {
+			row[i] = rgb(img.At(x0+i, y))
+		}
+	}
+}
+
+func rgbAt(img image.Image, x, y int) color.RGBA {
+	var px [1]color.RGBA
+	readRow(img, y, x, px[:])
+	return px[0]
+}
+
+func Pixels(img image.Image) []color.RGBA {
+	b := img.Bounds()
+	pixels := make([]color.RGBA, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := (y - b.Min.Y) * b.Dx()
+		readRow(img, y, b.Min.X, pixels[i:i+b.Dx()])
+	}
+	return pixels
+}
@@ -0,0 +1,197 @@
+package binarize
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+// atImage hides the concrete type of an image, so readRow falls back to
+// converting every pixel returned by At as before the fast paths
+type atImage struct {
+	image.Image
+}
+
+var palette = []color.RGBA{
+	{0xf0, 0xf0, 0xf0, 0xff}, // text
+	{0x10, 0x10, 0x10, 0xff}, // outline
+	{0x40, 0x70, 0xa0, 0xff}, // background
+}
+
+func jitter(r *rand.Rand, v uint8) uint8 {
+	return uint8(min(max(int(v)+r.Intn(25)-12, 0), 255))
+}
+
+// frame fills a picture with blobs of the palette colors and some noise
+func frame(r *rand.Rand, b image.Rectangle, set func(x, y int, c color.RGBA)) {
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := palette[(x/7+y/5)%len(palette)]
+			if r.Intn(10) == 0 {
+				c = palette[r.Intn(len(palette))]
+			}
+			set(x, y, color.RGBA{jitter(r, c.R), jitter(r, c.G), jitter(r, c.B), 0xff})
+		}
+	}
+}
+
+func newYCbCr(r *rand.Rand, b image.Rectangle) *image.YCbCr {
+	img := image.NewYCbCr(b, image.YCbCrSubsampleRatio420)
+	frame(r, b, func(x, y int, c color.RGBA) {
+		yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+		img.Y[img.YOffset(x, y)] = yy
+		img.Cb[img.COffset(x, y)] = cb
+		img.Cr[img.COffset(x, y)] = cr
+	})
+	return img
+}
+
+func newRGBA(r *rand.Rand, b image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(b)
+	frame(r, b, func(x, y int, c color.RGBA) {
+		img.SetRGBA(x, y, c)
+	})
+	return img
+}
+
+func newNRGBA(r *rand.Rand, b image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(b)
+	frame(r, b, func(x, y int, c color.RGBA) {
+		a := uint8(0xff)
+		if r.Intn(4) == 0 {
+			a = uint8(r.Intn(256))
+		}
+		img.SetNRGBA(x, y, color.NRGBA{c.R, c.G, c.B, a})
+	})
+	return img
+}
+
+func newGrayImage(r *rand.Rand, b image.Rectangle) *image.Gray {
+	img := image.NewGray(b)
+	frame(r, b, func(x, y int, c color.RGBA) {
+		img.SetGray(x, y, color.Gray{c.G})
+	})
+	return img
+}
+
+func testFrames(r *rand.Rand, b image.Rectangle) map[string]image.Image {
+	frames := map[string]image.Image{
+		"YCbCr": newYCbCr(r, b),
+		"RGBA":  newRGBA(r, b),
+		"NRGBA": newNRGBA(r, b),
+		"Gray":  newGrayImage(r, b),
+	}
+	// an odd origin checks the chroma offsets of cropped frames
+	crop := image.Rect(b.Min.X+3, b.Min.Y+5, b.Max.X-7, b.Max.Y-1)
+	for name, img := range frames {
+		frames[name+"/crop"] = img.(SubImager).SubImage(crop)
+	}
+	frames["Canvas"] = &Canvas{
+		Image:  frames["RGBA/crop"],
+		Offset: image.Point{-2, 4},
+		Frame:  b,
+	}
+	return frames
+}
+
+func resetConfig() *config.BinarizeConfig {
+	config.Reset(nil)
+	cfg := &config.Value.Binarize
+	cfg.TextColors = []config.ColorGroup{config.MustNewColorGroup("#f0f0f0/16")}
+	cfg.Optitmizer.Border.Color = []config.ColorGroup{config.MustNewColorGroup("#101010/16")}
+	cfg.Optitmizer.Border.Level = config.MustNewRelativeValue("30%+0")
+	return cfg
+}
+
+func TestReadRow(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for name, img := range testFrames(r, image.Rect(10, 20, 90, 70)) {
+		b := img.Bounds()
+		row := make([]color.RGBA, b.Dx())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			readRow(img, y, b.Min.X, row)
+			for i, c := range row {
+				if want := rgb(img.At(b.Min.X+i, y)); c != want {
+					t.Fatalf("%s: readRow at (%d, %d) = %v, want %v", name, b.Min.X+i, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestBinarizeFastPath(t *testing.T) {
+	cfg := resetConfig()
+	r := rand.New(rand.NewSource(2))
+	for name, img := range testFrames(r, image.Rect(10, 20, 200, 120)) {
+		want, wantIndex := Binarize(atImage{img}, cfg)
+		got, gotIndex := Binarize(img, cfg)
+		if !bytes.Equal(got.Pix, want.Pix) || len(gotIndex) != len(wantIndex) {
+			t.Errorf("%s: binarized mask differs from At", name)
+			continue
+		}
+		wantOpt, kept := Optimize(atImage{img}, want, wantIndex, cfg)
+		gotOpt, _ := Optimize(img, got, gotIndex, cfg)
+		if len(kept) == 0 || len(kept) == len(wantIndex) {
+			t.Errorf("%s: %d of %d pixels kept, the border colors are not tested", name, len(kept), len(wantIndex))
+		}
+		if !bytes.Equal(gotOpt.Pix, wantOpt.Pix) {
+			t.Errorf("%s: optimized mask differs from At", name)
+		}
+	}
+}
+
+type benchPath struct {
+	name string
+	img  image.Image
+}
+
+// benchFrames returns 1080p frames read through At and through readRow
+func benchFrames() []benchPath {
+	r := rand.New(rand.NewSource(3))
+	bounds := image.Rect(0, 0, 1920, 1080)
+	paths := []benchPath{}
+	for _, f := range []benchPath{
+		{"YCbCr", newYCbCr(r, bounds)},
+		{"RGBA", newRGBA(r, bounds)},
+		{"NRGBA", newNRGBA(r, bounds)},
+	} {
+		paths = append(paths,
+			benchPath{f.name + "/At", atImage{f.img}},
+			benchPath{f.name + "/readRow", f.img},
+		)
+	}
+	return paths
+}
+
+func BenchmarkBinarize(b *testing.B) {
+	cfg := resetConfig()
+	for _, path := range benchFrames() {
+		b.Run(path.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				img, index := Binarize(path.img, cfg)
+				CoordPool.Put(index)
+				recycle(img)
+			}
+		})
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	cfg := resetConfig()
+	for _, path := range benchFrames() {
+		mask, index := Binarize(path.img, cfg)
+		b.Run(path.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				img, kept := Optimize(path.img, mask, index, cfg)
+				CoordPool.Put(kept)
+				recycle(img)
+			}
+		})
+		CoordPool.Put(index)
+		recycle(mask)
+	}
+}
@@ -0,0 +1,137 @@
+package binarize
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+func readPnmToken(r *bufio.Reader) (string, error) {
+	token := []byte{}
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, c)
+		}
+	}
+}
+
+func init() {
+	image.RegisterFormat("ppm", "P6", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pgm", "P5", decodePNM, decodePNMConfig)
+}
+
+func decodePNM(r io.Reader) (image.Image, error) {
+	return DecodePNM(bufio.NewReader(r))
+}
+
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	magic, w, h, err := readPnmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	if magic == "P5" {
+		return image.Config{ColorModel: color.GrayModel, Width: w, Height: h}, nil
+	}
+	return image.Config{ColorModel: color.RGBAModel, Width: w, Height: h}, nil
+}
+
+func readPnmHeader(r *bufio.Reader) (string, int, int, error) {
+	magic, err := readPnmToken(r)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if magic != "P5" && magic != "P6" {
+		return "", 0, 0, fmt.Errorf("unsupported pnm magic %q", magic)
+	}
+	var w, h, maxval int
+	for _, v := range []*int{&w, &h, &maxval} {
+		token, err := readPnmToken(r)
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("unable to read pnm header: %w", err)
+		}
+		if _, err := fmt.Sscanf(token, "%d", v); err != nil {
+			return "", 0, 0, fmt.Errorf("invalid pnm header field %q: %w", token, err)
+		}
+	}
+	if maxval != 255 {
+		return "", 0, 0, fmt.Errorf("unsupported pnm maxval %d", maxval)
+	}
+	return magic, w, h, nil
+}
+
+func DecodePNM(r *bufio.Reader) (image.Image, error) {
+	magic, w, h, err := readPnmHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if magic == "P5" {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			if _, err := io.ReadFull(r, img.Pix[y*img.Stride:y*img.Stride+w]); err != nil {
+				return nil, fmt.Errorf("unable to read pgm pixels: %w", err)
+			}
+		}
+		return img, nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	row := make([]byte, w*3)
+	for y := 0; y < h; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, fmt.Errorf("unable to read ppm pixels: %w", err)
+		}
+		pix := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		for x := 0; x < w; x++ {
+			pix[x*4+0] = row[x*3+0]
+			pix[x*4+1] = row[x*3+1]
+			pix[x*4+2] = row[x*3+2]
+			pix[x*4+3] = 0xff
+		}
+	}
+	return img, nil
+}
+
+// EncodePNM writes a pgm (P5) or ppm (P6) image, converting the colors when
+// they do not match the format
+func EncodePNM(w io.Writer, img image.Image, format string) error {
+	bw := bufio.NewWriter(w)
+	b := img.Bounds()
+	if format == "pgm" {
+		fmt.Fprintf(bw, "P5\n%d %d\n255\n", b.Dx(), b.Dy())
+		if g, ok := img.(*image.Gray); ok {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				i := g.PixOffset(b.Min.X, y)
+				bw.Write(g.Pix[i : i+b.Dx()])
+			}
+			return bw.Flush()
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				bw.WriteByte(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+		}
+		return bw.Flush()
+	}
+	fmt.Fprintf(bw, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := rgb(img.At(x, y))
+			bw.Write([]byte{c.R, c.G, c.B})
+		}
+	}
+	return bw.Flush()
+}
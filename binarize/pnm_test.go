@@ -0,0 +1,58 @@
+package binarize
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodePNM(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	b := image.Rect(3, 5, 40, 30)
+	tests := []struct {
+		name   string
+		img    image.Image
+		format string
+		magic  string
+	}{
+		{"RGBA as pgm", newRGBA(r, b), "pgm", "P5"},
+		{"YCbCr as pgm", newYCbCr(r, b), "pgm", "P5"},
+		{"Gray as pgm", newGrayImage(r, b), "pgm", "P5"},
+		{"Gray as ppm", newGrayImage(r, b), "ppm", "P6"},
+		{"NRGBA as ppm", newNRGBA(r, b), "ppm", "P6"},
+	}
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		if err := Encode(buf, tt.img, tt.format, 0); err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		if magic := string(buf.Bytes()[:2]); magic != tt.magic {
+			t.Errorf("%s: magic %s, want %s", tt.name, magic, tt.magic)
+			continue
+		}
+		decoded, err := DecodePNM(bufio.NewReader(buf))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err.Error())
+		}
+		if decoded.Bounds().Size() != b.Size() {
+			t.Errorf("%s: size %v, want %v", tt.name, decoded.Bounds().Size(), b.Size())
+			continue
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				var want, got color.Color = tt.img.At(x, y), decoded.At(x-b.Min.X, y-b.Min.Y)
+				if tt.format == "pgm" {
+					want = color.GrayModel.Convert(want)
+				} else {
+					want = rgb(want)
+				}
+				if rgb(got) != rgb(want) {
+					t.Fatalf("%s: pixel (%d, %d) = %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package binarize
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+// Prepare rescales, thickens and inverts a trimmed mask as configured in
+// ocr.image before it is encoded for the engine
+func Prepare(img *image.Gray) *image.Gray {
+	c := config.Value.Ocr.Image
+	if c.Height > 0 {
+		if xh := XHeight(img); xh > 0 && xh != c.Height {
+			f := float64(c.Height) / float64(xh)
+			b := img.Bounds()
+			w := max(int(math.Round(float64(b.Dx())*f)), 1)
+			h := max(int(math.Round(float64(b.Dy())*f)), 1)
+			img = resample(img, w, h, c.Resample)
+		}
+	}
+	if c.Thicken > 0 {
+		img = darken(img, c.Thicken)
+	}
+	if c.Polarity == "light" {
+		inverted := image.NewGray(img.Bounds())
+		for i, v := range img.Pix {
+			inverted.Pix[i] = whiteValue - v
+		}
+		img = inverted
+	}
+	return img
+}
+
+// XHeight estimates the height of lowercase letters as the median of the
+// core bands of lines, where rows hold at least half of the densest row
+func XHeight(img *image.Gray) int {
+	c := config.Value.Ocr.Lines
+	heights := []int{}
+	for _, l := range Lines(img, c.Gap, c.MinHeight) {
+		rows := make([]int, l.Dy())
+		peak := 0
+		for y := l.Min.Y; y < l.Max.Y; y++ {
+			for x := l.Min.X; x < l.Max.X; x++ {
+				if img.Pix[img.PixOffset(x, y)] == blackValue {
+					rows[y-l.Min.Y]++
+				}
+			}
+			peak = max(peak, rows[y-l.Min.Y])
+		}
+		core := 0
+		for _, n := range rows {
+			if n*2 >= peak {
+				core++
+			}
+		}
+		if core > 0 {
+			heights = append(heights, core)
+		}
+	}
+	if len(heights) == 0 {
+		return 0
+	}
+	sort.Ints(heights)
+	return heights[len(heights)/2]
+}
+
+type tap struct {
+	index  int
+	weight float64
+}
+
+// taps maps each destination pixel to the source pixels it is sampled from
+func taps(src, dst int, method string) [][]tap {
+	scale := float64(src) / float64(dst)
+	t := make([][]tap, dst)
+	for i := range t {
+		switch method {
+		case "nearest":
+			t[i] = []tap{{min(int((float64(i)+0.5)*scale), src-1), 1}}
+		case "bilinear":
+			x := (float64(i)+0.5)*scale - 0.5
+			x0 := int(math.Floor(x))
+			f := x - float64(x0)
+			t[i] = []tap{
+				{min(max(x0, 0), src-1), 1 - f},
+				{min(max(x0+1, 0), src-1), f},
+			}
+		case "area":
+			l, r := float64(i)*scale, float64(i+1)*scale
+			for j := int(l); j < src && float64(j) < r; j++ {
+				w := math.Min(r, float64(j+1)) - math.Max(l, float64(j))
+				if w > 0 {
+					t[i] = append(t[i], tap{j, w / scale})
+				}
+			}
+		}
+	}
+	return t
+}
+
+func resample(img *image.Gray, w, h int, method string) *image.Gray {
+	b := img.Bounds()
+	tx, ty := taps(b.Dx(), w, method), taps(b.Dy(), h, method)
+	rows := make([]float64, w*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		pix := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x, ts := range tx {
+			v := 0.0
+			for _, t := range ts {
+				v += float64(pix[t.index]) * t.weight
+			}
+			rows[y*w+x] = v
+		}
+	}
+	out := image.NewGray(image.Rect(0, 0, w, h).Add(b.Min))
+	for y, ts := range ty {
+		for x := 0; x < w; x++ {
+			v := 0.0
+			for _, t := range ts {
+				v += rows[t.index*w+x] * t.weight
+			}
+			out.Pix[y*out.Stride+x] = uint8(math.Min(math.Max(math.Round(v), 0), 255))
+		}
+	}
+	return out
+}
+
+// darken thickens strokes by taking the darkest pixel within radius r, the
+// same as dilating the text of a black and white mask
+func darken(img *image.Gray, r int) *image.Gray {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tmp := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		pix := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			v := uint8(whiteValue)
+			for i := max(x-r, 0); i <= min(x+r, w-1); i++ {
+				if pix[i] < v {
+					v = pix[i]
+				}
+			}
+			tmp[y*w+x] = v
+		}
+	}
+	out := image.NewGray(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(whiteValue)
+			for i := max(y-r, 0); i <= min(y+r, h-1); i++ {
+				if tmp[i*w+x] < v {
+					v = tmp[i*w+x]
+				}
+			}
+			out.Pix[y*out.Stride+x] = v
+		}
+	}
+	return out
+}
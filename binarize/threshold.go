@@ -0,0 +1,141 @@
+package binarize
+
+import (
+	"image"
+	"math"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+// darkness maps pixels so that text is always darker than its background
+func darkness(img image.Image, polarity string) []int {
+	light := polarity == "light"
+	pixels := Pixels(img)
+	d := make([]int, len(pixels))
+	for i, c := range pixels {
+		l := (299*int(c.R) + 587*int(c.G) + 114*int(c.B) + 500) / 1000
+		if light {
+			l = 255 - l
+		}
+		d[i] = l
+	}
+	return d
+}
+
+func otsu(d []int) int {
+	hist := [256]int{}
+	sum := 0
+	for _, v := range d {
+		hist[v]++
+		sum += v
+	}
+	best, threshold := -1.0, 0
+	sumB, weightB := 0, 0
+	for t := 0; t < 256; t++ {
+		weightB += hist[t]
+		weightF := len(d) - weightB
+		if weightB == 0 {
+			continue
+		}
+		if weightF == 0 {
+			break
+		}
+		sumB += t * hist[t]
+		mB := float64(sumB) / float64(weightB)
+		mF := float64(sum-sumB) / float64(weightF)
+		between := float64(weightB) * float64(weightF) * (mB - mF) * (mB - mF)
+		if between > best {
+			best, threshold = between, t
+		}
+	}
+	return threshold
+}
+
+type integral struct {
+	w, h int
+	sum  []float64
+}
+
+func newIntegral(w, h int, value func(i int) float64) *integral {
+	in := &integral{w: w, h: h, sum: make([]float64, (w+1)*(h+1))}
+	for y := 0; y < h; y++ {
+		row := 0.0
+		for x := 0; x < w; x++ {
+			row += value(y*w + x)
+			in.sum[(y+1)*(w+1)+x+1] = in.sum[y*(w+1)+x+1] + row
+		}
+	}
+	return in
+}
+
+// window returns the sum and the area of the window of radius r around (x, y)
+func (in *integral) window(x, y, r int) (float64, float64) {
+	x0, y0 := max(x-r, 0), max(y-r, 0)
+	x1, y1 := min(x+r+1, in.w), min(y+r+1, in.h)
+	w := in.w + 1
+	s := in.sum[y1*w+x1] - in.sum[y0*w+x1] - in.sum[y1*w+x0] + in.sum[y0*w+x0]
+	return s, float64((x1 - x0) * (y1 - y0))
+}
+
+func binarizeThreshold(img image.Image, bc *config.BinarizeConfig) (*image.Gray, []Coordinate) {
+	cfg := bc.Threshold
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	d := darkness(img, cfg.Polarity)
+	var isText func(x, y int) bool
+	switch bc.Mode {
+	case "otsu":
+		t := otsu(d)
+		isText = func(x, y int) bool {
+			return d[y*w+x] <= t
+		}
+	case "niblack", "sauvola":
+		r := cfg.Window / 2
+		s1 := newIntegral(w, h, func(i int) float64 { return float64(d[i]) })
+		s2 := newIntegral(w, h, func(i int) float64 { return float64(d[i] * d[i]) })
+		sauvola := bc.Mode == "sauvola"
+		isText = func(x, y int) bool {
+			sum, n := s1.window(x, y, r)
+			sq, _ := s2.window(x, y, r)
+			m := sum / n
+			s := math.Sqrt(math.Max(sq/n-m*m, 0))
+			t := m - cfg.K*s
+			if sauvola {
+				t = m * (1 + cfg.K*(s/cfg.R-1))
+			}
+			return float64(d[y*w+x]) <= t
+		}
+	case "outline":
+		text, outline := 255-cfg.Text, 255-cfg.Outline
+		if cfg.Polarity == "dark" {
+			text, outline = cfg.Text, cfg.Outline
+		}
+		near := newIntegral(w, h, func(i int) float64 {
+			if d[i] >= outline {
+				return 1
+			}
+			return 0
+		})
+		isText = func(x, y int) bool {
+			if d[y*w+x] > text {
+				return false
+			}
+			n, _ := near.window(x, y, cfg.Radius)
+			return n > 0
+		}
+	}
+	imgNew := newGray(b)
+	index := CoordPool.Get().([]Coordinate)[:0]
+	for y := 0; y < h; y++ {
+		pix := imgNew.Pix[imgNew.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			if isText(x, y) {
+				pix[x] = blackValue
+				index = append(index, Coordinate{b.Min.X + x, b.Min.Y + y})
+			} else {
+				pix[x] = whiteValue
+			}
+		}
+	}
+	return imgNew, index
+}
@@ -1,69 +1,133 @@
 package check
 
 import (
-	"bytes"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/piggynl/subtitle/binarize"
 	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/manifest"
 	"github.com/piggynl/subtitle/ocr"
-	"github.com/piggynl/subtitle/util"
 )
 
 func Check(ctx *cli.Context) error {
 	filename := ctx.String("input")
+	if dir, ok := manifest.Find(filename); ok {
+		m, err := manifest.Load(dir)
+		if err != nil {
+			log.Fatalf("unable to load manifest: %s", err.Error())
+		}
+		if err := m.Apply(ctx.Bool("strict")); err != nil {
+			log.Fatal(err)
+		}
+		if m.Source != nil {
+			log.Printf("frames were sliced from %s", m.Source.Path)
+		}
+		if rel, err := filepath.Rel(dir, filename); err == nil {
+			for _, f := range m.Frames {
+				if f.Name == filepath.ToSlash(rel) {
+					log.Printf("frame at %s", f.Time)
+				}
+			}
+		}
+	}
 	binarize.Init()
 	source, err := binarize.Load(filename)
 	if err != nil {
 		log.Fatal(err)
 	}
 	bounds := source.Bounds()
-	cropped := binarize.Crop(source.(binarize.SubImager))
-	binaried, index1 := binarize.Binarize(cropped)
-	optimized, index2 := binarize.Optimize(cropped, binaried, index1)
-	trimed := binarize.Trim(optimized, index2)
+	mask := image.NewRGBA(bounds)
+	draw.Draw(mask, bounds, image.NewUniform(config.Value.Check.Cropped.Color), image.Point{}, draw.Src)
+	trimed := make([]*image.Gray, len(binarize.Regions))
+	for i, r := range binarize.Regions {
+		cfg := &binarize.Regions[i].BinarizeConfig
+		morphology := cfg.Optitmizer.Morphology
+		crop := binarize.CropRect(bounds, cfg)
+		cropped := binarize.Crop(source.(binarize.SubImager), cfg)
+		binaried, index1 := binarize.Binarize(cropped, cfg)
+		stages := []stage{{"binarize", binaried}}
+		morphed := binaried
+		for _, op := range morphology.Before {
+			morphed = binarize.Morph(morphed, op)
+			stages = append(stages, stage{op.Op, morphed})
+		}
+		if morphed != binaried {
+			index1 = binarize.Index(morphed)
+		}
+		optimized, index2 := binarize.Optimize(cropped, morphed, index1, cfg)
+		stages = append(stages, stage{"optimize", optimized})
+		morphed = optimized
+		for _, op := range morphology.After {
+			morphed = binarize.Morph(morphed, op)
+			stages = append(stages, stage{op.Op, morphed})
+		}
+		if morphed != optimized {
+			index2 = binarize.Index(morphed)
+		}
+		trimed[i] = binarize.Trim(morphed, index2)
+		paintMask(mask, crop, binaried, morphed)
+		if ctx.IsSet("output") && len(stages) > 2 {
+			saveStages(ctx.String("output"), r.Name, source, crop, stages)
+		}
+	}
 	if ctx.IsSet("output") {
-		mask := image.NewRGBA(bounds)
-		paintMask(mask, binaried, optimized)
 		output := renderOutput(source, mask)
 		binarize.Save(ctx.String("output"), output, config.Value.Ocr.Format, config.Value.Ocr.JpgQuality)
 	}
-	if trimed == nil {
-		log.Print("no text detected")
-	} else {
-		buf := util.BufferPool.Get().(*bytes.Buffer)
-		buf.Reset()
-		if err := binarize.Encode(buf, trimed, config.Value.Ocr.Format, config.Value.Ocr.JpgQuality); err != nil {
-			log.Print(err)
-		}
-		ocr.Init()
-		result, err := ocr.GetText(buf.Bytes())
+	initted := false
+	for i, r := range binarize.Regions {
+		prefix := ""
+		if len(r.Name) > 0 {
+			prefix = fmt.Sprintf("[%s] ", r.Name)
+		}
+		if trimed[i] == nil {
+			log.Printf("%sno text detected", prefix)
+			continue
+		}
+		if !initted {
+			ocr.Init(1)
+			initted = true
+		}
+		if ctx.IsSet("ocr-input") {
+			inputs := ocr.Inputs(trimed[i])
+			for n, in := range inputs {
+				name := suffixed(ctx.String("ocr-input"), r.Name)
+				if len(inputs) > 1 {
+					name = suffixed(name, fmt.Sprintf("line%d", n+1))
+				}
+				if err := binarize.Save(name, in, config.Value.Ocr.Format, config.Value.Ocr.JpgQuality); err != nil {
+					log.Fatal(err)
+				}
+				log.Printf("%simage sent to ocr saved to %s", prefix, name)
+			}
+		}
+		result, err := ocr.Recognize(ctx.Context, trimed[i])
 		if err != nil {
 			log.Fatal(err)
 		}
-		util.BufferPool.Put(buf)
-		fmt.Println(result)
-		ocr.StopTesseract()
+		if result.Confidence >= 0 {
+			log.Printf("%sconfidence: %.2f", prefix, result.Confidence)
+		}
+		fmt.Printf("%s%s\n", prefix, result.Text)
+	}
+	if initted {
+		ocr.Stop()
 	}
 	return nil
 }
 
-func paintMask(mask *image.RGBA, bin, opt *image.Gray) {
-	b := mask.Bounds()
-	minX := b.Min.X + config.Value.Binarize.Crop.Left.Calculate(b.Dx())
-	maxX := b.Min.X + config.Value.Binarize.Crop.Right.Calculate(b.Dx())
-	minY := b.Min.Y + config.Value.Binarize.Crop.Top.Calculate(b.Dy())
-	maxY := b.Min.Y + config.Value.Binarize.Crop.Bottom.Calculate(b.Dy())
-	for x := b.Min.X; x < b.Max.X; x++ {
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			if x <= minX || x >= maxX || y <= minY || y >= maxY {
-				mask.Set(x, y, config.Value.Check.Cropped.Color)
-			} else if bin.GrayAt(x, y).Y == 0 && opt.GrayAt(x, y).Y == 255 {
+func paintMask(mask *image.RGBA, crop image.Rectangle, bin, opt *image.Gray) {
+	for x := crop.Min.X + 1; x < crop.Max.X; x++ {
+		for y := crop.Min.Y + 1; y < crop.Max.Y; y++ {
+			if bin.GrayAt(x, y).Y == 0 && opt.GrayAt(x, y).Y == 255 {
 				mask.Set(x, y, config.Value.Check.Discarded.Color)
 			} else if opt.GrayAt(x, y).Y == 0 {
 				mask.Set(x, y, config.Value.Check.Text.Color)
@@ -74,6 +138,37 @@ func paintMask(mask *image.RGBA, bin, opt *image.Gray) {
 	}
 }
 
+type stage struct {
+	name string
+	img  *image.Gray
+}
+
+// saveStages renders the mask after each morphology operation next to the output
+func saveStages(output, region string, source image.Image, crop image.Rectangle, stages []stage) {
+	for n, s := range stages {
+		mask := image.NewRGBA(source.Bounds())
+		draw.Draw(mask, mask.Bounds(), image.NewUniform(config.Value.Check.Cropped.Color), image.Point{}, draw.Src)
+		paintMask(mask, crop, s.img, s.img)
+		name := suffixed(output, region, fmt.Sprintf("%d-%s", n, s.name))
+		if err := binarize.Save(name, renderOutput(source, mask), config.Value.Ocr.Format, config.Value.Ocr.JpgQuality); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("stage %d (%s) saved to %s", n, s.name, name)
+	}
+}
+
+// suffixed inserts the non-empty parts before the extension of name
+func suffixed(name string, parts ...string) string {
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	for _, p := range parts {
+		if len(p) > 0 {
+			name += "." + p
+		}
+	}
+	return name + ext
+}
+
 func renderOutput(source, mask image.Image) image.Image {
 	b := source.Bounds()
 	output := image.NewRGBA(b)
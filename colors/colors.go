@@ -0,0 +1,387 @@
+package colors
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"path"
+	"sort"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/piggynl/subtitle/binarize"
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/manifest"
+	"github.com/piggynl/subtitle/util"
+)
+
+type sample struct {
+	pixels []color.RGBA
+	width  int
+	labels []int
+}
+
+type cluster struct {
+	center color.RGBA
+	count  int
+	adj    []int
+}
+
+func Colors(ctx *cli.Context) error {
+	named := len(config.Value.Binarize.Regions) > 0
+	if named && ctx.Bool("write") {
+		log.Fatal("--write cannot update binarize.regions, copy the colors printed for each region into its settings instead")
+	}
+	regions, err := config.Value.Binarize.Resolve()
+	if err != nil {
+		log.Fatalf("invalid binarize.regions: %s", err.Error())
+	}
+	names := sampleNames(ctx)
+	if len(names) == 0 {
+		log.Fatal("no sample frames to analyze")
+	}
+	images := make([]binarize.SubImager, 0, len(names))
+	for _, name := range names {
+		img, err := binarize.Load(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		images = append(images, img.(binarize.SubImager))
+	}
+	var textColor config.ColorGroup
+	var borderColors []config.ColorGroup
+	for i := range regions {
+		if named {
+			log.Printf("discovering colors of region %q", regions[i].Name)
+			fmt.Printf("[%s]\n", regions[i].Name)
+		}
+		textColor, borderColors = discover(images, &regions[i].BinarizeConfig, ctx.Int("clusters"))
+	}
+	if ctx.Bool("write") {
+		// reload the file, as the manifest of frames may have changed slice settings
+		config.Load(ctx)
+		config.Value.Binarize.TextColors = []config.ColorGroup{textColor}
+		config.Value.Binarize.Optitmizer.Border.Color = borderColors
+		log.Printf("writing colors to %s", ctx.String("config"))
+		return config.Save(ctx)
+	}
+	return nil
+}
+
+func discover(images []binarize.SubImager, cfg *config.BinarizeConfig, k int) (config.ColorGroup, []config.ColorGroup) {
+	samples := make([]sample, 0, len(images))
+	points := []color.RGBA{}
+	for _, img := range images {
+		cropped := binarize.Crop(img, cfg)
+		s := sample{pixels: binarize.Pixels(cropped), width: cropped.Bounds().Dx()}
+		samples = append(samples, s)
+		points = append(points, s.pixels...)
+	}
+	log.Printf("analyzing %d pixels from %d frames", len(points), len(samples))
+
+	centers := merge(refine(points, medianCut(points, k)))
+	clusters := make([]cluster, len(centers))
+	for i := range clusters {
+		clusters[i] = cluster{center: centers[i], adj: make([]int, len(centers))}
+	}
+	total := 0
+	for i := range samples {
+		s := &samples[i]
+		s.labels = make([]int, len(s.pixels))
+		for j, c := range s.pixels {
+			s.labels[j] = nearest(centers, c)
+			clusters[s.labels[j]].count++
+		}
+		total += len(s.pixels)
+		for j, l := range s.labels {
+			if (j+1)%s.width != 0 && s.labels[j+1] != l {
+				clusters[l].adj[s.labels[j+1]]++
+				clusters[s.labels[j+1]].adj[l]++
+			}
+			if j+s.width < len(s.labels) && s.labels[j+s.width] != l {
+				clusters[l].adj[s.labels[j+s.width]]++
+				clusters[s.labels[j+s.width]].adj[l]++
+			}
+		}
+	}
+
+	background := 0
+	for i, c := range clusters {
+		if c.count > clusters[background].count {
+			background = i
+		}
+	}
+	fill, outline, best := -1, -1, -1.0
+	for i, c := range clusters {
+		neighbour, ratio := c.dominant()
+		log.Printf("cluster %s: %5.2f%% of pixels, %3.0f%% of edges next to %s",
+			hex(c.center), float64(c.count)*100/float64(total), ratio*100, hex(clusters[neighbour].center))
+		if i == background || c.count*2000 < total {
+			continue
+		}
+		// text surrounded by an outline beats text lying directly on the background
+		if neighbour != background {
+			ratio += 1
+		}
+		if ratio > best {
+			fill, outline, best = i, neighbour, ratio
+		}
+	}
+	if fill < 0 {
+		log.Fatal("unable to find text color, try other sample frames or a tighter binarize.crop")
+	}
+	if outline == background {
+		outline = -1
+	}
+
+	textColor := colorGroup(samples, clusters, fill)
+	printGroups("textColors", textColor)
+	borderColors := []config.ColorGroup{}
+	if outline >= 0 {
+		borderColors = append(borderColors, colorGroup(samples, clusters, outline))
+		printGroups("colors", borderColors[0])
+	} else {
+		log.Print("no outline color found")
+	}
+	return textColor, borderColors
+}
+
+func sampleNames(ctx *cli.Context) []string {
+	if ctx.IsSet("input") {
+		names := ctx.StringSlice("input")
+		if dir, ok := manifest.Find(names[0]); ok {
+			applyManifest(ctx, dir)
+		}
+		return names
+	}
+	if !ctx.IsSet("dir") {
+		log.Fatal("either sample frames or a frames directory is required")
+	}
+	dir := ctx.String("dir")
+	m := applyManifest(ctx, dir)
+	if m == nil {
+		log.Fatalf("no %s in %s, pass sample frames with --input instead", manifest.Filename, dir)
+	}
+	begin, err := util.ParseTimestamp(ctx.String("begin"))
+	if err != nil {
+		log.Fatalf("unable to parse beginning time: %s", err.Error())
+	}
+	end := m.End
+	if ctx.IsSet("end") {
+		if end, err = util.ParseTimestamp(ctx.String("end")); err != nil {
+			log.Fatalf("unable to parse endding time: %s", err.Error())
+		}
+	}
+	frames := []manifest.Frame{}
+	for _, f := range m.Frames {
+		if f.Time >= begin && f.Time < end {
+			frames = append(frames, f)
+		}
+	}
+	n := ctx.Int("samples")
+	names := []string{}
+	for i := 0; i < n && i < len(frames); i++ {
+		names = append(names, path.Join(dir, frames[i*len(frames)/min(n, len(frames))].Name))
+	}
+	return names
+}
+
+func applyManifest(ctx *cli.Context, dir string) *manifest.Manifest {
+	if !manifest.Exists(dir) {
+		return nil
+	}
+	m, err := manifest.Load(dir)
+	if err != nil {
+		log.Fatalf("unable to load manifest: %s", err.Error())
+	}
+	if err := m.Apply(false); err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+func (c *cluster) dominant() (int, float64) {
+	best, sum := 0, 0
+	for j, n := range c.adj {
+		sum += n
+		if n > c.adj[best] {
+			best = j
+		}
+	}
+	if sum == 0 {
+		return best, 0
+	}
+	return best, float64(c.adj[best]) / float64(sum)
+}
+
+func medianCut(points []color.RGBA, k int) []color.RGBA {
+	boxes := [][]color.RGBA{append([]color.RGBA{}, points...)}
+	for len(boxes) < k {
+		split, channel, widest := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				lo, hi := channelRange(box, ch)
+				if hi-lo > widest {
+					split, channel, widest = i, ch, hi-lo
+				}
+			}
+		}
+		if split < 0 {
+			break
+		}
+		box := boxes[split]
+		sort.Slice(box, func(i, j int) bool {
+			return channelOf(box[i], channel) < channelOf(box[j], channel)
+		})
+		mid := len(box) / 2
+		boxes[split] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+	centers := make([]color.RGBA, len(boxes))
+	for i, box := range boxes {
+		var r, g, b int
+		for _, c := range box {
+			r += int(c.R)
+			g += int(c.G)
+			b += int(c.B)
+		}
+		n := len(box)
+		centers[i] = color.RGBA{R: uint8((r + n/2) / n), G: uint8((g + n/2) / n), B: uint8((b + n/2) / n)}
+	}
+	return centers
+}
+
+func refine(points []color.RGBA, centers []color.RGBA) []color.RGBA {
+	stride := len(points)/100000 + 1
+	for iter := 0; iter < 10; iter++ {
+		sums := make([][4]int, len(centers))
+		for i := 0; i < len(points); i += stride {
+			c := points[i]
+			l := nearest(centers, c)
+			sums[l][0] += int(c.R)
+			sums[l][1] += int(c.G)
+			sums[l][2] += int(c.B)
+			sums[l][3]++
+		}
+		moved := false
+		for i, sum := range sums {
+			n := sum[3]
+			if n == 0 {
+				continue
+			}
+			c := color.RGBA{R: uint8((sum[0] + n/2) / n), G: uint8((sum[1] + n/2) / n), B: uint8((sum[2] + n/2) / n)}
+			moved = moved || c != centers[i]
+			centers[i] = c
+		}
+		if !moved {
+			break
+		}
+	}
+	return centers
+}
+
+func merge(centers []color.RGBA) []color.RGBA {
+	merged := []color.RGBA{}
+	for _, c := range centers {
+		same := false
+		for _, x := range merged {
+			if distance(x, c) <= 8 {
+				same = true
+				break
+			}
+		}
+		if !same {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+func distance(x, y color.RGBA) int {
+	d := abs(int(x.R)-int(y.R)) + abs(int(x.G)-int(y.G)) + abs(int(x.B)-int(y.B))
+	return (d + 2) / 3
+}
+
+func channelOf(c color.RGBA, ch int) int {
+	switch ch {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	default:
+		return int(c.B)
+	}
+}
+
+func channelRange(box []color.RGBA, ch int) (int, int) {
+	lo, hi := 255, 0
+	for _, c := range box {
+		v := channelOf(c, ch)
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	return lo, hi
+}
+
+func nearest(centers []color.RGBA, c color.RGBA) int {
+	best, bestD := 0, math.MaxInt32
+	for i, x := range centers {
+		dr := int(x.R) - int(c.R)
+		dg := int(x.G) - int(c.G)
+		db := int(x.B) - int(c.B)
+		if d := dr*dr + dg*dg + db*db; d < bestD {
+			best, bestD = i, d
+		}
+	}
+	return best
+}
+
+func colorGroup(samples []sample, clusters []cluster, label int) config.ColorGroup {
+	center := clusters[label].center
+	errors := []int{}
+	for _, s := range samples {
+		for j, c := range s.pixels {
+			if s.labels[j] == label {
+				errors = append(errors, distance(c, center))
+			}
+		}
+	}
+	sort.Ints(errors)
+	// leave out the most distant 5% which are mostly anti-aliased edges
+	return config.MustNewColorGroup(fmt.Sprintf("%s/%d", hex(center), errors[len(errors)*95/100]))
+}
+
+func printGroups(key string, cg config.ColorGroup) {
+	b, _ := json.Marshal([]config.ColorGroup{cg})
+	fmt.Printf("%q: %s\n", key, b)
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min(x, y int) int {
+	if x <= y {
+		return x
+	}
+	return y
+}
+
+func max(x, y int) int {
+	if x >= y {
+		return x
+	}
+	return y
+}
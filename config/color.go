@@ -0,0 +1,367 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	metricRGB = iota
+	metricHSV
+	metricDeltaE
+)
+
+type ColorGroup struct {
+	R, G, B uint8
+	Error   int
+	Color   color.RGBA
+
+	source string
+	metric int
+	hsv    [3]float64
+	hsvTol [3]float64
+	lab    [3]float64
+	deltaE float64
+	cache  *colorCache
+}
+
+func (cg *ColorGroup) Contains(c color.RGBA) bool {
+	switch cg.metric {
+	case metricRGB:
+		return (diff(cg.R, c.R) + diff(cg.G, c.G) + diff(cg.B, c.B)) <= cg.Error*3
+	}
+	if matched, known := cg.cache.lookup(c); known {
+		return matched
+	}
+	matched := false
+	switch cg.metric {
+	case metricHSV:
+		h, s, v := RGBToHSV(c)
+		matched = hueDiff(h, cg.hsv[0]) <= cg.hsvTol[0] &&
+			math.Abs(s-cg.hsv[1]) <= cg.hsvTol[1] &&
+			math.Abs(v-cg.hsv[2]) <= cg.hsvTol[2]
+	case metricDeltaE:
+		l, a, b := RGBToLab(c)
+		matched = CIEDE2000(l, a, b, cg.lab[0], cg.lab[1], cg.lab[2]) <= cg.deltaE
+	}
+	cg.cache.store(c, matched)
+	return matched
+}
+
+func MustNewColorGroup(s string) ColorGroup {
+	cg := new(ColorGroup)
+	if err := cg.Assign(s); err != nil {
+		panic(err)
+	}
+	return *cg
+}
+
+func (cg *ColorGroup) Assign(s string) error {
+	*cg = ColorGroup{}
+	spec, tol := strings.ReplaceAll(s, " ", ""), ""
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		spec, tol = spec[:i], spec[i+1:]
+	}
+	if err := cg.assignColor(spec); err != nil {
+		return fmt.Errorf("unable to assign %s to color group: %w", s, err)
+	}
+	if err := cg.assignTolerance(tol); err != nil {
+		return fmt.Errorf("unable to assign %s to color group: %w", s, err)
+	}
+	cg.Color = color.RGBA{uint8(cg.R), uint8(cg.G), uint8(cg.B), 0}
+	if cg.metric != metricRGB {
+		cg.source = s
+		cg.cache = new(colorCache)
+	}
+	return nil
+}
+
+func (cg *ColorGroup) assignColor(spec string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(spec, "#"):
+		_, err = fmt.Sscanf(spec, "#%02x%02x%02x", &cg.R, &cg.G, &cg.B)
+	case strings.HasPrefix(spec, "rgb("):
+		_, err = fmt.Sscanf(spec, "rgb(%d,%d,%d)", &cg.R, &cg.G, &cg.B)
+	case strings.HasPrefix(spec, "hsv("):
+		h, s, v := &cg.hsv[0], &cg.hsv[1], &cg.hsv[2]
+		if _, err = fmt.Sscanf(spec, "hsv(%g,%g%%,%g%%)", h, s, v); err == nil {
+			c := HSVToRGB(*h, *s, *v)
+			cg.R, cg.G, cg.B = c.R, c.G, c.B
+			cg.lab[0], cg.lab[1], cg.lab[2] = RGBToLab(c)
+		}
+		return err
+	case strings.HasPrefix(spec, "lab("):
+		l, a, b := &cg.lab[0], &cg.lab[1], &cg.lab[2]
+		if _, err = fmt.Sscanf(spec, "lab(%g,%g,%g)", l, a, b); err == nil {
+			c := LabToRGB(*l, *a, *b)
+			cg.R, cg.G, cg.B = c.R, c.G, c.B
+			cg.hsv[0], cg.hsv[1], cg.hsv[2] = RGBToHSV(c)
+		}
+		return err
+	default:
+		return fmt.Errorf("unrecognized color %q", spec)
+	}
+	if err == nil {
+		c := color.RGBA{cg.R, cg.G, cg.B, 0}
+		cg.hsv[0], cg.hsv[1], cg.hsv[2] = RGBToHSV(c)
+		cg.lab[0], cg.lab[1], cg.lab[2] = RGBToLab(c)
+	}
+	return err
+}
+
+func (cg *ColorGroup) assignTolerance(tol string) error {
+	switch {
+	case tol == "":
+		return nil
+	case strings.HasPrefix(tol, "ΔE") || strings.HasPrefix(tol, "dE"):
+		cg.metric = metricDeltaE
+		var err error
+		cg.deltaE, err = strconv.ParseFloat(strings.TrimPrefix(strings.TrimPrefix(tol, "ΔE"), "dE"), 64)
+		return err
+	case strings.ContainsAny(tol, "hsv"):
+		cg.metric = metricHSV
+		for _, part := range strings.Split(tol, ",") {
+			if len(part) < 2 {
+				return fmt.Errorf("invalid hsv tolerance %q", part)
+			}
+			i := strings.IndexByte("hsv", part[0])
+			if i < 0 {
+				return fmt.Errorf("invalid hsv channel %q", part[:1])
+			}
+			v, err := strconv.ParseFloat(strings.TrimSuffix(part[1:], "%"), 64)
+			if err != nil {
+				return err
+			}
+			cg.hsvTol[i] = v
+		}
+		return nil
+	default:
+		var err error
+		cg.Error, err = strconv.Atoi(tol)
+		return err
+	}
+}
+
+func (cg *ColorGroup) String() string {
+	if cg.source != "" {
+		return cg.source
+	}
+	if cg.Error == 0 {
+		return fmt.Sprintf("#%02x%02x%02x", cg.R, cg.G, cg.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x/%d", cg.R, cg.G, cg.B, cg.Error)
+}
+
+func (cg ColorGroup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cg.String())
+}
+
+func (cg *ColorGroup) UnmarshalJSON(b []byte) error {
+	var s string
+	json.Unmarshal(b, &s)
+	return cg.Assign(s)
+}
+
+// two bits per 24-bit color: whether it is known, and whether it matches
+type colorCache struct {
+	once sync.Once
+	bits []uint32
+}
+
+func (cc *colorCache) word(c color.RGBA) (*uint32, uint) {
+	cc.once.Do(func() {
+		cc.bits = make([]uint32, 1<<24/16)
+	})
+	k := uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+	return &cc.bits[k/16], uint(k%16) * 2
+}
+
+func (cc *colorCache) lookup(c color.RGBA) (bool, bool) {
+	w, shift := cc.word(c)
+	v := atomic.LoadUint32(w) >> shift
+	return v&2 != 0, v&1 != 0
+}
+
+func (cc *colorCache) store(c color.RGBA, matched bool) {
+	w, shift := cc.word(c)
+	bits := uint32(1)
+	if matched {
+		bits |= 2
+	}
+	for {
+		old := atomic.LoadUint32(w)
+		if atomic.CompareAndSwapUint32(w, old, old|bits<<shift) {
+			return
+		}
+	}
+}
+
+func RGBToHSV(c color.RGBA) (float64, float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	d := max - min
+	h := 0.0
+	switch {
+	case d == 0:
+	case max == r:
+		h = 60 * math.Mod((g-b)/d+6, 6)
+	case max == g:
+		h = 60 * ((b-r)/d + 2)
+	default:
+		h = 60 * ((r-g)/d + 4)
+	}
+	s := 0.0
+	if max > 0 {
+		s = d / max
+	}
+	return h, s * 100, max * 100
+}
+
+func HSVToRGB(h, s, v float64) color.RGBA {
+	s, v = s/100, v/100
+	c := v * s
+	hh := math.Mod(h, 360) / 60
+	x := c * (1 - math.Abs(math.Mod(hh, 2)-1))
+	var r, g, b float64
+	switch {
+	case hh < 1:
+		r, g, b = c, x, 0
+	case hh < 2:
+		r, g, b = x, c, 0
+	case hh < 3:
+		r, g, b = 0, c, x
+	case hh < 4:
+		r, g, b = 0, x, c
+	case hh < 5:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return color.RGBA{R: to8(r + m), G: to8(g + m), B: to8(b + m)}
+}
+
+func hueDiff(x, y float64) float64 {
+	d := math.Abs(x - y)
+	return math.Min(d, 360-d)
+}
+
+func to8(x float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, x)) * 255))
+}
+
+func linearize(c uint8) float64 {
+	x := float64(c) / 255
+	if x <= 0.04045 {
+		return x / 12.92
+	}
+	return math.Pow((x+0.055)/1.055, 2.4)
+}
+
+func delinearize(x float64) uint8 {
+	if x <= 0.0031308 {
+		return to8(x * 12.92)
+	}
+	return to8(1.055*math.Pow(x, 1/2.4) - 0.055)
+}
+
+// D65 reference white
+const xn, yn, zn = 0.95047, 1.0, 1.08883
+
+func RGBToLab(c color.RGBA) (float64, float64, float64) {
+	r, g, b := linearize(c.R), linearize(c.G), linearize(c.B)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / xn
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / yn
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / zn
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return t*24389/27/116 + 16.0/116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func LabToRGB(l, a, b float64) color.RGBA {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	f := func(t float64) float64 {
+		if t*t*t > 216.0/24389 {
+			return t * t * t
+		}
+		return (t - 16.0/116) * 116 * 27 / 24389
+	}
+	x, y, z := f(fx)*xn, f(fy)*yn, f(fz)*zn
+	return color.RGBA{
+		R: delinearize(3.2404542*x - 1.5371385*y - 0.4985314*z),
+		G: delinearize(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+		B: delinearize(0.0556434*x - 0.2040259*y + 1.0572252*z),
+	}
+}
+
+func CIEDE2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	sq := func(x float64) float64 { return x * x }
+	pow7 := math.Pow(25, 7)
+	c7 := math.Pow((math.Hypot(a1, b1)+math.Hypot(a2, b2))/2, 7)
+	g := 0.5 * (1 - math.Sqrt(c7/(c7+pow7)))
+	a1, a2 = (1+g)*a1, (1+g)*a2
+	c1, c2 := math.Hypot(a1, b1), math.Hypot(a2, b2)
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1, h2 := hue(b1, a1), hue(b2, a2)
+
+	dl := l2 - l1
+	dc := c2 - c1
+	dh := 0.0
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(rad(dh/2))
+
+	lm := (l1 + l2) / 2
+	cm := (c1 + c2) / 2
+	hm := h1 + h2
+	if c1*c2 != 0 {
+		switch {
+		case math.Abs(h1-h2) <= 180:
+			hm /= 2
+		case h1+h2 < 360:
+			hm = (hm + 360) / 2
+		default:
+			hm = (hm - 360) / 2
+		}
+	}
+	t := 1 - 0.17*math.Cos(rad(hm-30)) + 0.24*math.Cos(rad(2*hm)) + 0.32*math.Cos(rad(3*hm+6)) - 0.20*math.Cos(rad(4*hm-63))
+	theta := 30 * math.Exp(-sq((hm-275)/25))
+	cm7 := math.Pow(cm, 7)
+	rc := 2 * math.Sqrt(cm7/(cm7+pow7))
+	sl := 1 + 0.015*sq(lm-50)/math.Sqrt(20+sq(lm-50))
+	sc := 1 + 0.045*cm
+	sh := 1 + 0.015*cm*t
+	rt := -math.Sin(rad(2*theta)) * rc
+	return math.Sqrt(sq(dl/sl) + sq(dc/sc) + sq(dH/sh) + rt*(dc/sc)*(dH/sh))
+}
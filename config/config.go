@@ -16,6 +16,7 @@ type Config struct {
 	Check     CheckConfig     `json:"check"`
 	Ocr       OcrConfig       `json:"ocr"`
 	Convert   ConvertConfig   `json:"convert"`
+	Adaptive  AdaptiveConfig  `json:"adaptive"`
 }
 
 type FfmpegConfig struct {
@@ -33,21 +34,45 @@ type SliceConfig struct {
 	FpsFactor     int    `json:"fpsFactor"`
 	FrameInterval int    `json:"frameInterval"`
 	Format        string `json:"format"`
+	Crop          bool   `json:"crop"`
 }
 
 type BinarizeConfig struct {
 	Crop       Area            `json:"crop"`
+	Mode       string          `json:"mode"`
 	TextColors []ColorGroup    `json:"textColors"`
+	Threshold  ThresholdConfig `json:"threshold"`
 	Optitmizer OptimizerConfig `json:"optimizer"`
+	Regions    []RegionConfig  `json:"regions"`
+}
+
+type ThresholdConfig struct {
+	Polarity string  `json:"polarity"`
+	Window   int     `json:"window"`
+	K        float64 `json:"k"`
+	R        float64 `json:"r"`
+	Text     int     `json:"text"`
+	Outline  int     `json:"outline"`
+	Radius   int     `json:"radius"`
 }
 
 type OptimizerConfig struct {
-	Connectivity int            `json:"connectivity"`
-	Size         Range          `json:"size"`
-	Width        Range          `json:"width"`
-	Height       Range          `json:"height"`
-	Border       BorderConfig   `json:"border"`
-	NoOnEdge     NoOnEdgeConfig `json:"noOnEdge"`
+	Connectivity int              `json:"connectivity"`
+	Size         Range            `json:"size"`
+	Width        Range            `json:"width"`
+	Height       Range            `json:"height"`
+	Border       BorderConfig     `json:"border"`
+	AspectRatio  FloatRange       `json:"aspectRatio"`
+	Density      FloatRange       `json:"density"`
+	Solidity     FloatRange       `json:"solidity"`
+	Stroke       StrokeConfig     `json:"stroke"`
+	NoOnEdge     NoOnEdgeConfig   `json:"noOnEdge"`
+	Morphology   MorphologyConfig `json:"morphology"`
+}
+
+type StrokeConfig struct {
+	Width     Range   `json:"width"`
+	Variation float64 `json:"variation"`
 }
 
 type BorderConfig struct {
@@ -71,11 +96,29 @@ type CheckConfig struct {
 }
 
 type OcrConfig struct {
+	Engine     string        `json:"engine"`
+	Results    string        `json:"results"`
 	Cache      RelativeValue `json:"cache"`
 	Margin     MarginConfig  `json:"margin"`
 	Format     string        `json:"format"`
 	JpgQuality int           `json:"jpgQuality"`
 	Replace    []Replace     `json:"replace"`
+	Lines      LinesConfig   `json:"lines"`
+	Image      ImageConfig   `json:"image"`
+}
+
+type ImageConfig struct {
+	Height   int    `json:"height"`
+	Resample string `json:"resample"`
+	Thicken  int    `json:"thicken"`
+	Polarity string `json:"polarity"`
+}
+
+type LinesConfig struct {
+	Split     bool          `json:"split"`
+	Gap       RelativeValue `json:"gap"`
+	MinHeight RelativeValue `json:"minHeight"`
+	Psm       int           `json:"psm"`
 }
 
 type MarginConfig struct {
@@ -93,11 +136,41 @@ type ConvertConfig struct {
 	Replace []Replace     `json:"replace"`
 	Format  string        `json:"format"`
 	Merge   RelativeValue `json:"merge"`
+	Ass     AssConfig     `json:"ass"`
+	Vtt     VttConfig     `json:"vtt"`
+}
+
+type VttConfig struct {
+	Settings bool   `json:"settings"`
+	Align    string `json:"align"`
+}
+
+type AssConfig struct {
+	Font         string     `json:"font"`
+	Size         int        `json:"size"`
+	Bold         bool       `json:"bold"`
+	PrimaryColor ColorGroup `json:"primaryColor"`
+	OutlineColor ColorGroup `json:"outlineColor"`
+	BackColor    ColorGroup `json:"backColor"`
+	Outline      float64    `json:"outline"`
+	Shadow       float64    `json:"shadow"`
+	Alignment    int        `json:"alignment"`
+	MarginL      int        `json:"marginL"`
+	MarginR      int        `json:"marginR"`
+	MarginV      int        `json:"marginV"`
+	Position     bool       `json:"position"`
+}
+
+type AdaptiveConfig struct {
+	Rate      string        `json:"rate"`
+	Threshold RelativeValue `json:"threshold"`
+	Precision int           `json:"precision"` // milliseconds
 }
 
 var Value Config
 
 func Load(ctx *cli.Context) error {
+	Reset(ctx)
 	file, err := os.Open(ctx.String("config"))
 	if err != nil {
 		log.Fatal(err)
@@ -147,7 +220,17 @@ func Reset(*cli.Context) error {
 				Top:    MustNewRelativeValue("0%+0"),
 				Bottom: MustNewRelativeValue("100%+0"),
 			},
+			Mode:       "colors",
 			TextColors: []ColorGroup{},
+			Threshold: ThresholdConfig{
+				Polarity: "light",
+				Window:   31,
+				K:        0.2,
+				R:        128,
+				Text:     200,
+				Outline:  80,
+				Radius:   3,
+			},
 			Optitmizer: OptimizerConfig{
 				Connectivity: 8,
 				Size:         MustNewRange("0%+0", "100%+0"),
@@ -157,13 +240,25 @@ func Reset(*cli.Context) error {
 					Color: []ColorGroup{},
 					Level: MustNewRelativeValue("0%+0"),
 				},
+				AspectRatio: FloatRange{0, 1000},
+				Density:     FloatRange{0, 1},
+				Solidity:    FloatRange{0, 1},
+				Stroke: StrokeConfig{
+					Width:     MustNewRange("0%+0", "100%+0"),
+					Variation: 0,
+				},
 				NoOnEdge: NoOnEdgeConfig{
 					Left:   false,
 					Right:  false,
 					Top:    false,
 					Bottom: false,
 				},
+				Morphology: MorphologyConfig{
+					Before: []Morphology{},
+					After:  []Morphology{},
+				},
 			},
+			Regions: []RegionConfig{},
 		},
 		Check: CheckConfig{
 			MaskLevel:  0.8,
@@ -173,7 +268,9 @@ func Reset(*cli.Context) error {
 			Text:       MustNewColorGroup("#ff0000"),
 		},
 		Ocr: OcrConfig{
-			Cache: MustNewRelativeValue("0%+0"),
+			Engine:  "tesseract",
+			Results: "jsonl",
+			Cache:   MustNewRelativeValue("0%+0"),
 			Margin: MarginConfig{
 				X: MustNewRelativeValue("0%+20"),
 				Y: MustNewRelativeValue("0%+20"),
@@ -187,11 +284,47 @@ func Reset(*cli.Context) error {
 					To:     " ",
 				},
 			},
+			Lines: LinesConfig{
+				Split:     false,
+				Gap:       MustNewRelativeValue("0%+1"),
+				MinHeight: MustNewRelativeValue("20%+0"),
+				Psm:       7,
+			},
+			Image: ImageConfig{
+				Height:   0,
+				Resample: "area",
+				Thicken:  0,
+				Polarity: "dark",
+			},
 		},
 		Convert: ConvertConfig{
 			Replace: []Replace{},
 			Merge:   MustNewRelativeValue("0%+0"),
 			Format:  "srt",
+			Ass: AssConfig{
+				Font:         "Arial",
+				Size:         48,
+				Bold:         false,
+				PrimaryColor: MustNewColorGroup("#ffffff"),
+				OutlineColor: MustNewColorGroup("#000000"),
+				BackColor:    MustNewColorGroup("#000000"),
+				Outline:      2,
+				Shadow:       0,
+				Alignment:    2,
+				MarginL:      20,
+				MarginR:      20,
+				MarginV:      40,
+				Position:     false,
+			},
+			Vtt: VttConfig{
+				Settings: false,
+				Align:    "center",
+			},
+		},
+		Adaptive: AdaptiveConfig{
+			Rate:      "2",
+			Threshold: MustNewRelativeValue("0.1%+0"),
+			Precision: 40,
 		},
 	}
 	return nil
@@ -3,7 +3,6 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"image/color"
 )
 
 func diff(x, y uint8) int {
@@ -56,55 +55,6 @@ func (rv RelativeValue) MarshalJSON() ([]byte, error) {
 	return json.Marshal(rv.String())
 }
 
-type ColorGroup struct {
-	R, G, B uint8
-	Error   int
-	Color   color.RGBA
-}
-
-func (cg *ColorGroup) Contains(c color.RGBA) bool {
-	return (diff(cg.R, c.R) + diff(cg.G, c.G) + diff(cg.B, c.B)) <= cg.Error*3
-}
-
-func MustNewColorGroup(s string) ColorGroup {
-	cg := new(ColorGroup)
-	if err := cg.Assign(s); err != nil {
-		panic(err)
-	}
-	return *cg
-}
-
-func (cg *ColorGroup) Assign(s string) error {
-	var err error
-	if len(s) == len("#rrggbb") {
-		_, err = fmt.Sscanf(s, "#%02x%02x%02x", &cg.R, &cg.G, &cg.B)
-	} else {
-		_, err = fmt.Sscanf(s, "#%02x%02x%02x/%d", &cg.R, &cg.G, &cg.B, &cg.Error)
-	}
-	if err != nil {
-		return fmt.Errorf("unable to assign %s to color group: %w", s, err)
-	}
-	cg.Color = color.RGBA{uint8(cg.R), uint8(cg.G), uint8(cg.B), 0}
-	return nil
-}
-
-func (cg *ColorGroup) String() string {
-	if cg.Error == 0 {
-		return fmt.Sprintf("#%02x%02x%02x", cg.R, cg.G, cg.B)
-	}
-	return fmt.Sprintf("#%02x%02x%02x/%d", cg.R, cg.G, cg.B, cg.Error)
-}
-
-func (cg ColorGroup) MarshalJSON() ([]byte, error) {
-	return json.Marshal(cg.String())
-}
-
-func (cg *ColorGroup) UnmarshalJSON(b []byte) error {
-	var s string
-	json.Unmarshal(b, &s)
-	return cg.Assign(s)
-}
-
 type Range struct {
 	Min RelativeValue `json:"min"`
 	Max RelativeValue `json:"max"`
@@ -114,6 +64,15 @@ func MustNewRange(min, max string) Range {
 	return Range{MustNewRelativeValue(min), MustNewRelativeValue(max)}
 }
 
+type FloatRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (fr FloatRange) Contains(v float64) bool {
+	return v >= fr.Min && v <= fr.Max
+}
+
 type Area struct {
 	Left   RelativeValue `json:"left"`
 	Right  RelativeValue `json:"right"`
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type MorphologyConfig struct {
+	Before []Morphology `json:"before"`
+	After  []Morphology `json:"after"`
+}
+
+// Morphology is an operation written as "op" or "op:N", where N is the
+// radius of the square structuring element, or the largest hole to fill
+type Morphology struct {
+	Op   string
+	Size int
+}
+
+func (m *Morphology) Assign(s string) error {
+	op, size := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		op, size = s[:i], s[i+1:]
+	}
+	switch op {
+	case "dilate", "erode", "open", "close":
+		m.Size = 1
+	case "fill":
+		m.Size = 0
+	default:
+		return fmt.Errorf("unsupported morphology operation %q, available: dilate, erode, open, close, fill", op)
+	}
+	m.Op = op
+	if len(size) > 0 {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid size of morphology operation %q", s)
+		}
+		m.Size = n
+	}
+	return nil
+}
+
+func (m Morphology) String() string {
+	if m.Op == "fill" && m.Size == 0 {
+		return m.Op
+	}
+	return fmt.Sprintf("%s:%d", m.Op, m.Size)
+}
+
+func (m *Morphology) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return m.Assign(s)
+}
+
+func (m Morphology) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type RegionConfig struct {
+	Name      string
+	overrides json.RawMessage
+}
+
+type Region struct {
+	Name string
+	BinarizeConfig
+}
+
+func (rc *RegionConfig) UnmarshalJSON(b []byte) error {
+	n := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return fmt.Errorf("unable to parse region: %w", err)
+	}
+	if n.Name == "" {
+		return fmt.Errorf("region without name: %s", b)
+	}
+	rc.Name = n.Name
+	rc.overrides = append(json.RawMessage{}, b...)
+	return nil
+}
+
+func (rc RegionConfig) MarshalJSON() ([]byte, error) {
+	return rc.overrides, nil
+}
+
+// Resolve applies the overrides of each region to a copy of the shared
+// settings, or returns the shared settings as the only unnamed region.
+func (bc *BinarizeConfig) Resolve() ([]Region, error) {
+	if len(bc.Regions) == 0 {
+		return []Region{{BinarizeConfig: *bc}}, nil
+	}
+	base := *bc
+	base.Regions = nil
+	b, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	regions := []Region{}
+	seen := map[string]bool{}
+	for _, rc := range bc.Regions {
+		if seen[rc.Name] {
+			return nil, fmt.Errorf("region %q defined twice", rc.Name)
+		}
+		seen[rc.Name] = true
+		r := Region{Name: rc.Name}
+		if err := json.Unmarshal(b, &r.BinarizeConfig); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(rc.overrides, &r.BinarizeConfig); err != nil {
+			return nil, fmt.Errorf("unable to apply region %q: %w", rc.Name, err)
+		}
+		r.Regions = nil
+		regions = append(regions, r)
+	}
+	return regions, nil
+}
@@ -0,0 +1,139 @@
+package conv
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/result"
+	"github.com/piggynl/subtitle/util"
+)
+
+var defaultPlayRes = image.Rect(0, 0, 1920, 1080)
+
+func assColor(cg config.ColorGroup) string {
+	return fmt.Sprintf("&H00%02X%02X%02X", cg.B, cg.G, cg.R)
+}
+
+func assTime(t util.Timestamp) string {
+	return fmt.Sprintf("%d:%02d:%02d.%02d", t.Hours(), t.Minutes(), t.Seconds(), t.Milliseconds()/10)
+}
+
+// braces start override tags in ass, so they are replaced with full-width ones
+var assEscaper = strings.NewReplacer("{", "｛", "}", "｝")
+
+func assText(s string) string {
+	s = assEscaper.Replace(strings.TrimRight(s, "\n"))
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\\N")
+}
+
+func assAnchor(box image.Rectangle, alignment int) image.Point {
+	p := image.Point{}
+	switch (alignment - 1) % 3 {
+	case 0:
+		p.X = box.Min.X
+	case 1:
+		p.X = (box.Min.X + box.Max.X) / 2
+	case 2:
+		p.X = box.Max.X
+	}
+	switch (alignment - 1) / 3 {
+	case 0:
+		p.Y = box.Max.Y
+	case 1:
+		p.Y = (box.Min.Y + box.Max.Y) / 2
+	case 2:
+		p.Y = box.Min.Y
+	}
+	return p
+}
+
+type assStyle struct {
+	name      string
+	layer     int
+	alignment int
+}
+
+// assStyles gives every named region a style on its own layer, and moves
+// regions in the upper half of the frame to the top
+func assStyles() []assStyle {
+	styles := []assStyle{{"Default", 0, config.Value.Convert.Ass.Alignment}}
+	for i, r := range regions {
+		if len(r.Name) == 0 {
+			continue
+		}
+		s := assStyle{r.Name, i, config.Value.Convert.Ass.Alignment}
+		if r.Crop.Top.Calculate(10000)+r.Crop.Bottom.Calculate(10000) < 10000 {
+			s.alignment = (s.alignment-1)%3 + 7
+		}
+		styles = append(styles, s)
+	}
+	return styles
+}
+
+func writeAssHeader(w io.Writer, playRes image.Rectangle, styles []assStyle) {
+	c := config.Value.Convert.Ass
+	bold := 0
+	if c.Bold {
+		bold = -1
+	}
+	fmt.Fprintln(w, "[Script Info]")
+	fmt.Fprintln(w, "ScriptType: v4.00+")
+	fmt.Fprintln(w, "WrapStyle: 0")
+	fmt.Fprintln(w, "ScaledBorderAndShadow: yes")
+	fmt.Fprintf(w, "PlayResX: %d\n", playRes.Dx())
+	fmt.Fprintf(w, "PlayResY: %d\n", playRes.Dy())
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[V4+ Styles]")
+	fmt.Fprintln(w, "Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, "+
+		"Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, "+
+		"Alignment, MarginL, MarginR, MarginV, Encoding")
+	for _, s := range styles {
+		fmt.Fprintf(w, "Style: %s,%s,%d,%s,%s,%s,%s,%d,0,0,0,100,100,0,0,1,%g,%g,%d,%d,%d,%d,1\n",
+			s.name, c.Font, c.Size,
+			assColor(c.PrimaryColor), assColor(c.PrimaryColor), assColor(c.OutlineColor), assColor(c.BackColor),
+			bold, c.Outline, c.Shadow, s.alignment, c.MarginL, c.MarginR, c.MarginV,
+		)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Events]")
+	fmt.Fprintln(w, "Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text")
+}
+
+func formatAss(w io.Writer, ch <-chan result.Record) {
+	c := config.Value.Convert.Ass
+	first, ok := <-ch
+	playRes := defaultPlayRes
+	if ok && !first.Frame.Empty() {
+		playRes = first.Frame
+	}
+	styles := assStyles()
+	writeAssHeader(w, playRes, styles)
+	if !ok {
+		return
+	}
+	write := func(x result.Record) {
+		style := styles[0]
+		for _, s := range styles[1:] {
+			if s.name == x.Track {
+				style = s
+			}
+		}
+		tags := ""
+		if c.Position && !x.Box.Empty() && !x.Frame.Empty() {
+			p := assAnchor(x.Box.Sub(x.Frame.Min), style.alignment)
+			p.X = p.X * playRes.Dx() / x.Frame.Dx()
+			p.Y = p.Y * playRes.Dy() / x.Frame.Dy()
+			tags = fmt.Sprintf("{\\pos(%d,%d)}", p.X, p.Y)
+		}
+		fmt.Fprintf(w, "Dialogue: %d,%s,%s,%s,,0,0,0,,%s%s\n",
+			style.layer, assTime(x.Begin), assTime(x.End), style.name, tags, assText(x.Text))
+	}
+	write(first)
+	for x := range ch {
+		write(x)
+	}
+}
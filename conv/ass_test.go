@@ -0,0 +1,22 @@
+package conv
+
+import "testing"
+
+func TestAssText(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"hello", "hello"},
+		{"hello\n", "hello"},
+		{"first\nsecond", "first\\Nsecond"},
+		{"first\r\nsecond\n", "first\\Nsecond"},
+		{"{\\b1}bold{\\b0}", "｛\\b1｝bold｛\\b0｝"},
+		{"a {note} here", "a ｛note｝ here"},
+		{"}{", "｝｛"},
+	}
+	for _, tt := range tests {
+		if got := assText(tt.input); got != tt.want {
+			t.Errorf("assText(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
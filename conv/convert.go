@@ -1,112 +1,167 @@
 package conv
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"time"
+	"path"
+	"strings"
+	"sync"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/result"
 	"github.com/piggynl/subtitle/util"
 )
 
-type subtitleItem struct {
-	t1, t2 time.Duration
-	f1, f2 int
-	text   string
-}
-
 func Convert(ctx *cli.Context) error {
 	input, err := os.Open(ctx.String("input"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer input.Close()
-	output, err := os.Create(ctx.String("output"))
-	if err != nil {
-		log.Fatal(err)
+	Run(input, ctx.String("output"))
+	return nil
+}
+
+var regions []config.Region
+
+// formats that keep all tracks in one file, the others get a file per track
+var multiTrack = map[string]bool{
+	"raw":   true,
+	"jsonl": true,
+	"ass":   true,
+}
+
+func trackFilename(output, track string) string {
+	if len(track) == 0 {
+		return output
 	}
-	defer output.Close()
-	ch := make(chan subtitleItem)
+	ext := path.Ext(output)
+	return strings.TrimSuffix(output, ext) + "." + track + ext
+}
+
+func region(track string) config.Region {
+	for _, r := range regions {
+		if r.Name == track {
+			return r
+		}
+	}
+	return config.Region{Name: track, BinarizeConfig: config.Value.Binarize}
+}
+
+func Run(input io.Reader, output string) {
 	format, ok := formatter[config.Value.Convert.Format]
 	if !ok {
 		log.Fatalf("unsupported format %q", config.Value.Convert.Format)
 	}
-	go func(input *os.File) {
-		var err error
-		replacer := util.MustNewReplacer(config.Value.Convert.Replace)
-		scanner := bufio.NewScanner(input)
-		lineNum := 0
-		p := subtitleItem{}
-		for scanner.Scan() {
-			lineNum++
-			l := scanner.Text()
-			x := subtitleItem{}
-			var s1, s2 string
-			if _, err = fmt.Sscanf(l, "%8s/%02d->%8s/%02d %q", &s1, &x.f1, &s2, &x.f2, &x.text); err != nil {
-				log.Fatalf("failed to parse line %d: %s", lineNum, err.Error())
-			}
-			if x.t1, err = util.ParseDuration(s1); err != nil {
-				log.Fatalf("failed to parse line %d: %s", lineNum, err.Error())
-			}
-			if x.t2, err = util.ParseDuration(s2); err != nil {
-				log.Fatalf("failed to parse line %d: %s", lineNum, err.Error())
-			}
-			x.text = replacer.Replace(x.text)
-			if util.Silimar(p.text, x.text, config.Value.Convert.Merge) && p.t2 == x.t1 && p.f2 == x.f1 {
-				p.t2 = x.t2
-				p.f2 = x.f2
-			} else {
-				if len(p.text) > 0 {
-					ch <- p
-				}
-				p = x
+	var err error
+	if regions, err = config.Value.Binarize.Resolve(); err != nil {
+		log.Fatalf("invalid binarize.regions: %s", err.Error())
+	}
+	outputs := map[string]chan<- result.Record{}
+	wg := sync.WaitGroup{}
+	open := func(track string) chan<- result.Record {
+		if multiTrack[config.Value.Convert.Format] {
+			track = ""
+		}
+		if ch, ok := outputs[track]; ok {
+			return ch
+		}
+		file, err := os.Create(trackFilename(output, track))
+		if err != nil {
+			log.Fatal(err)
+		}
+		ch := make(chan result.Record)
+		outputs[track] = ch
+		wg.Add(1)
+		go func() {
+			format(file, ch)
+			file.Close()
+			wg.Done()
+		}()
+		return ch
+	}
+
+	replacer := util.MustNewReplacer(config.Value.Convert.Replace)
+	reader := result.NewReader(input)
+	pending := map[string]*result.Record{}
+	tracks := []string{}
+	for {
+		x, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		x.Text = replacer.Replace(x.Text)
+		p, ok := pending[x.Track]
+		if !ok {
+			p = &result.Record{}
+			pending[x.Track] = p
+			tracks = append(tracks, x.Track)
+		}
+		if util.Silimar(p.Text, x.Text, config.Value.Convert.Merge) && p.End == x.Begin {
+			p.Merge(x)
+		} else {
+			if len(p.Text) > 0 {
+				open(p.Track) <- *p
 			}
+			*p = x
 		}
-		if len(p.text) > 0 {
-			ch <- p
+	}
+	for _, t := range tracks {
+		if p := pending[t]; len(p.Text) > 0 {
+			open(t) <- *p
 		}
+	}
+	if len(outputs) == 0 {
+		open("")
+	}
+	for _, ch := range outputs {
 		close(ch)
-	}(input)
-	format(output, ch)
-	return nil
+	}
+	wg.Wait()
 }
 
-var formatter = map[string]func(*os.File, <-chan subtitleItem){
-	"raw": func(w *os.File, ch <-chan subtitleItem) {
+var formatter = map[string]func(io.Writer, <-chan result.Record){
+	"raw": func(w io.Writer, ch <-chan result.Record) {
 		for x := range ch {
-			fmt.Fprintf(w, "%s/%02d->%s/%02d %q\n",
-				util.FormatDuration(x.t1), x.f1,
-				util.FormatDuration(x.t2), x.f2,
-				x.text,
-			)
+			fmt.Fprintln(w, x)
+		}
+	},
+	"jsonl": func(w io.Writer, ch <-chan result.Record) {
+		rw, _ := result.NewWriter(w, "jsonl")
+		for x := range ch {
+			rw.Write(x)
 		}
 	},
-	"srt": func(w *os.File, ch <-chan subtitleItem) {
+	"srt": func(w io.Writer, ch <-chan result.Record) {
 		id := 0
-		r := 1000.0 / float64(config.Value.Slice.Fps*config.Value.Slice.FpsFactor)
 		for x := range ch {
 			id++
 			fmt.Fprintf(w, "%d\n", id)
 			fmt.Fprintf(w, "%s,%03d --> %s,%03d\n",
-				util.FormatDuration(x.t1), int(r*float64(x.f1)),
-				util.FormatDuration(x.t2), int(r*float64(x.f2)),
+				x.Begin.Clock(), x.Begin.Milliseconds(),
+				x.End.Clock(), x.End.Milliseconds(),
 			)
-			fmt.Fprintf(w, "%s\n\n", x.text)
+			fmt.Fprintf(w, "%s\n\n", x.Text)
 		}
 	},
-	"lrc": func(w *os.File, ch <-chan subtitleItem) {
-		r := 1000.0 / float64(config.Value.Slice.Fps*config.Value.Slice.FpsFactor)
+	"lrc": func(w io.Writer, ch <-chan result.Record) {
 		for x := range ch {
-			fmt.Fprintf(w, "[%s.%02d]%s\n", util.FormatDuration(x.t1), int(r*float64(x.f1)), x.text)
+			text := strings.ReplaceAll(strings.TrimSpace(x.Text), "\n", " ")
+			fmt.Fprintf(w, "[%s.%02d]%s\n", x.Begin.Clock(), x.Begin.Milliseconds()/10, text)
 		}
 	},
-	"plain": func(w *os.File, ch <-chan subtitleItem) {
+	"ass": formatAss,
+	"vtt": formatVtt,
+	"plain": func(w io.Writer, ch <-chan result.Record) {
 		for x := range ch {
-			fmt.Fprintln(w, x.text)
+			fmt.Fprintln(w, x.Text)
 		}
 	},
 }
@@ -0,0 +1,94 @@
+package conv
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/result"
+)
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func vttText(s string) string {
+	lines := []string{}
+	for _, l := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		if l = strings.TrimSpace(l); len(l) > 0 {
+			lines = append(lines, vttEscaper.Replace(l))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func percent(v, base int) float64 {
+	p := float64(v) * 100 / float64(base)
+	if p < 0 {
+		return 0
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
+
+func vttSettings(x result.Record) string {
+	c := config.Value.Convert.Vtt
+	var line, position float64
+	if !x.Box.Empty() && !x.Frame.Empty() {
+		box := x.Box.Sub(x.Frame.Min)
+		line = percent(box.Max.Y, x.Frame.Dy())
+		switch c.Align {
+		case "start", "left":
+			position = percent(box.Min.X, x.Frame.Dx())
+		case "end", "right":
+			position = percent(box.Max.X, x.Frame.Dx())
+		default:
+			position = percent((box.Min.X+box.Max.X)/2, x.Frame.Dx())
+		}
+	} else {
+		crop := region(x.Track).Crop
+		frame := x.Frame
+		if frame.Empty() {
+			frame = image.Rect(0, 0, 10000, 10000)
+		}
+		line = percent(crop.Bottom.Calculate(frame.Dy()), frame.Dy())
+		left := crop.Left.Calculate(frame.Dx())
+		right := crop.Right.Calculate(frame.Dx())
+		switch c.Align {
+		case "start", "left":
+			position = percent(left, frame.Dx())
+		case "end", "right":
+			position = percent(right, frame.Dx())
+		default:
+			position = percent((left+right)/2, frame.Dx())
+		}
+	}
+	return fmt.Sprintf(" line:%.2f%%,end position:%.2f%% align:%s", line, position, c.Align)
+}
+
+func formatVtt(w io.Writer, ch <-chan result.Record) {
+	switch config.Value.Convert.Vtt.Align {
+	case "start", "center", "end", "left", "right":
+	default:
+		log.Fatalf("unsupported vtt cue alignment %q", config.Value.Convert.Vtt.Align)
+	}
+	fmt.Fprint(w, "WEBVTT\n\n")
+	id := 0
+	for x := range ch {
+		text := vttText(x.Text)
+		if len(text) == 0 {
+			continue
+		}
+		id++
+		settings := ""
+		if config.Value.Convert.Vtt.Settings {
+			settings = vttSettings(x)
+		}
+		fmt.Fprintf(w, "%d\n", id)
+		fmt.Fprintf(w, "%s --> %s%s\n", x.Begin, x.End, settings)
+		fmt.Fprintf(w, "%s\n\n", text)
+	}
+}
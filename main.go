@@ -8,9 +8,11 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/piggynl/subtitle/check"
+	"github.com/piggynl/subtitle/colors"
 	"github.com/piggynl/subtitle/config"
 	"github.com/piggynl/subtitle/conv"
 	"github.com/piggynl/subtitle/ocr"
+	"github.com/piggynl/subtitle/run"
 	"github.com/piggynl/subtitle/slice"
 	"github.com/piggynl/subtitle/util"
 )
@@ -50,14 +52,13 @@ var sharedFlags = map[string]cli.Flag{
 		Name:    "begin",
 		Aliases: []string{"s"},
 		Value:   "00:00:00",
-		Usage:   "specify `TIME` of beginning, formatted in hh:mm:ss",
+		Usage:   "specify `TIME` of beginning, formatted in hh:mm:ss[.mmm]",
 	},
 	"end": &cli.StringFlag{
 		Name:        "end",
 		Aliases:     []string{"t"},
-		Value:       "99:59:59",
 		DefaultText: "auto detect",
-		Usage:       "specify `TIME` of ending, formatted in hh:mm:ss",
+		Usage:       "specify `TIME` of ending, formatted in hh:mm:ss[.mmm]",
 	},
 	"output": &cli.StringFlag{
 		Name:     "output",
@@ -65,6 +66,10 @@ var sharedFlags = map[string]cli.Flag{
 		Required: true,
 		Usage:    "save OCR results to `FILE` (required)",
 	},
+	"strict": &cli.BoolFlag{
+		Name:  "strict",
+		Usage: "fail instead of warning when configuration disagrees with the manifest of frames",
+	},
 	"concurrency": &cli.IntFlag{
 		Name:    "concurrency",
 		Aliases: []string{"j"},
@@ -118,6 +123,9 @@ func main() {
 					sharedFlags["dir"],
 					sharedFlags["begin"],
 					sharedFlags["end"],
+					overwrite(sharedFlags["concurrency"], map[string]interface{}{
+						"Usage": "split video into X segments sliced by parallel ffmpeg processes",
+					}),
 				},
 				Before: config.Load,
 				Action: slice.Slice,
@@ -134,10 +142,53 @@ func main() {
 						"Required": false,
 						"Usage":    "save debugging image to `FILE`",
 					}),
+					&cli.StringFlag{
+						Name:    "ocr-input",
+						Aliases: []string{"O"},
+						Usage:   "save images sent to the ocr engine to `FILE`",
+					},
+					sharedFlags["strict"],
 				},
 				Before: config.Load,
 				Action: check.Check,
 			},
+			&cli.Command{
+				Name:  "colors",
+				Usage: "discover text and outline colors from sample frames",
+				Flags: []cli.Flag{
+					sharedFlags["config"],
+					&cli.StringSliceFlag{
+						Name:    "input",
+						Aliases: []string{"i"},
+						Usage:   "use `IMAGE` as sample frame, can be repeated",
+					},
+					overwrite(sharedFlags["dir"], map[string]interface{}{
+						"Required": false,
+						"Usage":    "pick sample frames from `DIR` sliced with a manifest",
+					}),
+					sharedFlags["begin"],
+					sharedFlags["end"],
+					&cli.IntFlag{
+						Name:    "samples",
+						Aliases: []string{"n"},
+						Value:   16,
+						Usage:   "pick `N` frames evenly from DIR",
+					},
+					&cli.IntFlag{
+						Name:    "clusters",
+						Aliases: []string{"k"},
+						Value:   8,
+						Usage:   "group pixel colors into `K` clusters",
+					},
+					&cli.BoolFlag{
+						Name:    "write",
+						Aliases: []string{"w"},
+						Usage:   "save discovered colors into the configuration file",
+					},
+				},
+				Before: config.Load,
+				Action: colors.Colors,
+			},
 			&cli.Command{
 				Name:  "ocr",
 				Usage: "run OCR to extract subtitles from frames",
@@ -148,6 +199,12 @@ func main() {
 					sharedFlags["end"],
 					sharedFlags["output"],
 					sharedFlags["concurrency"],
+					sharedFlags["strict"],
+					&cli.BoolFlag{
+						Name:    "resume",
+						Aliases: []string{"r"},
+						Usage:   "skip frames recorded in the checkpoint of an interrupted run",
+					},
 				},
 				Before: config.Load,
 				Action: ocr.Ocr,
@@ -167,9 +224,30 @@ func main() {
 				Before: config.Load,
 				Action: conv.Convert,
 			},
+			&cli.Command{
+				Name:  "run",
+				Usage: "extract subtitles from video in one pass without storing frames",
+				Flags: []cli.Flag{
+					sharedFlags["config"],
+					sharedFlags["input"],
+					sharedFlags["begin"],
+					sharedFlags["end"],
+					overwrite(sharedFlags["output"], map[string]interface{}{
+						"Usage": "save formatted subtitles to `FILE` (required)",
+					}),
+					sharedFlags["concurrency"],
+					&cli.BoolFlag{
+						Name:    "adaptive",
+						Aliases: []string{"a"},
+						Usage:   "sample sparsely and bisect subtitle boundaries by seeking",
+					},
+				},
+				Before: config.Load,
+				Action: run.Run,
+			},
 		},
 	}
-	if err := app.Run(os.Args); err != nil {
+	if err := app.RunContext(util.SignalContext(), os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+
+	"github.com/piggynl/subtitle/binarize"
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/util"
+)
+
+const Filename = "manifest.json"
+
+type Manifest struct {
+	Source   *Source        `json:"source,omitempty"`
+	Probe    *Probe         `json:"probe,omitempty"`
+	Settings *Settings      `json:"settings,omitempty"`
+	Crop     *Crop          `json:"crop,omitempty"`
+	Args     [][]string     `json:"args,omitempty"`
+	Begin    util.Timestamp `json:"begin"`
+	End      util.Timestamp `json:"end"`
+	Frames   []Frame        `json:"frames"`
+}
+
+type Source struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+type Crop struct {
+	X           int `json:"x"`
+	Y           int `json:"y"`
+	Width       int `json:"width"`
+	Height      int `json:"height"`
+	FrameWidth  int `json:"frameWidth"`
+	FrameHeight int `json:"frameHeight"`
+}
+
+type Settings struct {
+	Slice   config.SliceConfig `json:"slice"`
+	Filters []string           `json:"filters"`
+}
+
+type Probe struct {
+	Duration  util.Timestamp `json:"duration"`
+	FrameRate string         `json:"frameRate"`
+	Codec     string         `json:"codec"`
+	Width     int            `json:"width"`
+	Height    int            `json:"height"`
+}
+
+type Frame struct {
+	Name string         `json:"name"`
+	Time util.Timestamp `json:"time"`
+}
+
+func CurrentSettings() *Settings {
+	return &Settings{
+		Slice:   config.Value.Slice,
+		Filters: config.Value.Ffmpeg.Filters,
+	}
+}
+
+func NewSource(name string) (*Source, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to hash %q: %w", name, err)
+	}
+	return &Source{
+		Path: abs,
+		Size: size,
+		Hash: "sha256:" + hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+func Exists(dir string) bool {
+	_, err := os.Stat(path.Join(dir, Filename))
+	return err == nil
+}
+
+func Load(dir string) (*Manifest, error) {
+	file, err := os.Open(path.Join(dir, Filename))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m := new(Manifest)
+	if err := json.NewDecoder(file).Decode(m); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Find looks for the manifest next to a frame or one level up, where it is
+// saved for frames in hXXmYY directories, so an unrelated manifest.json
+// further up is never picked up
+func Find(name string) (string, bool) {
+	dir := filepath.Dir(name)
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		if Exists(d) {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+func (m *Manifest) Apply(strict bool) error {
+	if m.Settings == nil {
+		log.Print("manifest does not record slice settings, using current configuration")
+		return nil
+	}
+	cur := CurrentSettings()
+	diff := []string{}
+	if m.Settings.Slice != cur.Slice {
+		diff = append(diff, fmt.Sprintf("slice settings %+v (configured %+v)", m.Settings.Slice, cur.Slice))
+	}
+	if !reflect.DeepEqual(m.Settings.Filters, cur.Filters) {
+		diff = append(diff, fmt.Sprintf("ffmpeg filters %q (configured %q)", m.Settings.Filters, cur.Filters))
+	}
+	for _, d := range diff {
+		log.Printf("frames were sliced with %s", d)
+	}
+	if len(diff) > 0 && strict {
+		return fmt.Errorf("configuration disagrees with manifest in %d settings", len(diff))
+	}
+	config.Value.Slice = m.Settings.Slice
+	if m.Crop != nil {
+		frame := image.Rect(0, 0, m.Crop.FrameWidth, m.Crop.FrameHeight)
+		offset := image.Point{m.Crop.X, m.Crop.Y}
+		cropped := image.Rect(m.Crop.X, m.Crop.Y, m.Crop.X+m.Crop.Width, m.Crop.Y+m.Crop.Height)
+		regions, err := config.Value.Binarize.Resolve()
+		if err != nil {
+			return err
+		}
+		if !binarize.CropUnion(frame, regions).In(cropped) {
+			log.Printf("binarize.crop exceeds the area %dx%d%+d%+d cropped by ffmpeg", m.Crop.Width, m.Crop.Height, m.Crop.X, m.Crop.Y)
+			if strict {
+				return fmt.Errorf("configuration disagrees with the crop of frames")
+			}
+		}
+		binarize.SetCanvas(frame, offset)
+	}
+	return nil
+}
+
+func (m *Manifest) Save(dir string) error {
+	file, err := os.Create(path.Join(dir, Filename))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("unable to encode manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package ocr
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/piggynl/subtitle/util"
+)
+
+type checkpointEntry struct {
+	Name    string             `json:"name,omitempty"`
+	Time    util.Timestamp     `json:"time"`
+	End     util.Timestamp     `json:"end"`
+	Frame   [4]int             `json:"frame"`
+	Regions []checkpointRegion `json:"regions"`
+}
+
+type checkpointRegion struct {
+	Status string  `json:"status"`
+	Text   string  `json:"text"`
+	Conf   float64 `json:"confidence"`
+	Box    [4]int  `json:"box"`
+}
+
+type Checkpoint struct {
+	name   string
+	file   *os.File
+	replay []pipelineTask
+}
+
+func OpenCheckpoint(name string, resume bool, regions int) (*Checkpoint, error) {
+	c := &Checkpoint{name: name}
+	if !resume {
+		file, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		c.file = file
+		return c, nil
+	}
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+	r := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		l, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		e := checkpointEntry{}
+		if err := json.Unmarshal(l, &e); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("malformed checkpoint entry %d: %w", len(c.replay)+1, err)
+		}
+		if len(e.Regions) != regions {
+			file.Close()
+			return nil, fmt.Errorf("checkpoint entry %d has %d regions, %d configured", len(c.replay)+1, len(e.Regions), regions)
+		}
+		task := pipelineTask{
+			seq:     len(c.replay),
+			name:    e.Name,
+			time:    e.Time,
+			end:     e.End,
+			bounds:  image.Rect(e.Frame[0], e.Frame[1], e.Frame[2], e.Frame[3]),
+			regions: make([]regionResult, len(e.Regions)),
+		}
+		for i, r := range e.Regions {
+			task.regions[i] = regionResult{
+				status: r.Status,
+				text:   r.Text,
+				conf:   r.Conf,
+				box:    image.Rect(r.Box[0], r.Box[1], r.Box[2], r.Box[3]),
+			}
+		}
+		c.replay = append(c.replay, task)
+		offset += int64(len(l))
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Checkpoint) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.replay)
+}
+
+func (c *Checkpoint) append(task pipelineTask) error {
+	if c == nil {
+		return nil
+	}
+	e := checkpointEntry{
+		Name:  task.name,
+		Time:  task.time,
+		End:   task.end,
+		Frame: [4]int{task.bounds.Min.X, task.bounds.Min.Y, task.bounds.Max.X, task.bounds.Max.Y},
+	}
+	for _, r := range task.regions {
+		e.Regions = append(e.Regions, checkpointRegion{
+			Status: r.status,
+			Text:   r.text,
+			Conf:   r.conf,
+			Box:    [4]int{r.box.Min.X, r.box.Min.Y, r.box.Max.X, r.box.Max.Y},
+		})
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = c.file.Write(append(b, '\n'))
+	return err
+}
+
+func (c *Checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.file.Close()
+	return os.Remove(c.name)
+}
@@ -0,0 +1,53 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Capabilities struct {
+	Concurrent bool
+	Confidence bool
+}
+
+type Recognition struct {
+	Text       string
+	Confidence float64
+}
+
+type Engine interface {
+	Setup() error
+	Recognize(ctx context.Context, image []byte) (Recognition, error)
+	Close() error
+	Capabilities() Capabilities
+}
+
+var VersionTag = ""
+
+var engines = make(map[string]func() Engine)
+
+func Register(name string, factory func() Engine) {
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("ocr engine %q registered twice", name))
+	}
+	engines[name] = factory
+}
+
+func Engines() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewEngine(name string) (Engine, error) {
+	factory, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported ocr engine %q, available: %s", name, strings.Join(Engines(), ", "))
+	}
+	return factory(), nil
+}
@@ -4,38 +4,57 @@
 package ocr
 
 import (
-	"log"
-	"sync"
+	"context"
 
 	"github.com/otiai10/gosseract/v2"
 
 	"github.com/piggynl/subtitle/config"
 )
 
-const VersionTag = " (built with gosseract)"
-
-var (
-	lock   sync.Mutex
+type gosseractEngine struct {
 	client *gosseract.Client
-)
+}
 
-func SetupTesseract() {
-	client = gosseract.NewClient()
-	client.SetLanguage(config.Value.Tesseract.Langs...)
-	client.SetPageSegMode(gosseract.PageSegMode(config.Value.Tesseract.Psm))
+func init() {
+	VersionTag = " (built with gosseract)"
+	Register("gosseract", func() Engine {
+		return new(gosseractEngine)
+	})
+}
+
+func (e *gosseractEngine) Setup() error {
+	e.client = gosseract.NewClient()
+	if err := e.client.SetLanguage(config.Value.Tesseract.Langs...); err != nil {
+		return err
+	}
+	return e.client.SetPageSegMode(gosseract.PageSegMode(pageSegMode()))
 }
 
-func StopTesseract() {
-	client.Close()
+func (e *gosseractEngine) Close() error {
+	return e.client.Close()
 }
 
-func RunTesseract(image []byte) (string, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	if err := client.SetImageFromBytes(image); err != nil {
-		log.Print(err)
-		return "", err
+func (e *gosseractEngine) Capabilities() Capabilities {
+	return Capabilities{Concurrent: false, Confidence: true}
+}
+
+func (e *gosseractEngine) Recognize(ctx context.Context, image []byte) (Recognition, error) {
+	if err := e.client.SetImageFromBytes(image); err != nil {
+		return Recognition{}, err
+	}
+	text, err := e.client.Text()
+	if err != nil {
+		return Recognition{}, err
+	}
+	r := Recognition{Text: text, Confidence: -1}
+	boxes, err := e.client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil || len(boxes) == 0 {
+		return r, nil
+	}
+	r.Confidence = 0
+	for _, b := range boxes {
+		r.Confidence += b.Confidence
 	}
-	out, err := client.Text()
-	return out, err
+	r.Confidence /= float64(len(boxes))
+	return r, nil
 }
@@ -2,138 +2,385 @@ package ocr
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"image"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/piggynl/subtitle/binarize"
 	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/manifest"
+	"github.com/piggynl/subtitle/result"
 	"github.com/piggynl/subtitle/util"
 )
 
-type pipelineTask struct {
-	name   string
-	time   time.Duration
-	frame  int
+type Frame struct {
+	Name  string
+	Time  util.Timestamp
+	End   util.Timestamp
+	Image image.Image
+}
+
+type regionResult struct {
 	img    *image.Gray
+	box    image.Rectangle
+	crop   image.Rectangle
 	status string
 	text   string
+	conf   float64
+}
 
-	idle     int64
-	prevChan <-chan pipelineTask
-	nextChan chan<- pipelineTask
-	tokens   chan<- struct{}
-	stop     chan<- struct{}
-	result   chan<- pipelineTask
+type pipelineTask struct {
+	seq     int
+	name    string
+	time    util.Timestamp
+	end     util.Timestamp
+	source  image.Image
+	bounds  image.Rectangle
+	regions []regionResult
+
+	idle       int64
+	ctx        context.Context
+	prevChan   <-chan pipelineTask
+	nextChan   chan<- pipelineTask
+	recognized chan struct{}
+	tokens     chan<- struct{}
+	result     chan<- pipelineTask
 }
 
-var replacer util.Replacer
+const unbounded = util.Timestamp(math.MaxInt64)
+
+var (
+	replacer util.Replacer
+	workers  *Pool
+)
 
-func Init() {
+func Init(concurrency int) {
+	var err error
 	binarize.Init()
 	replacer = util.MustNewReplacer(config.Value.Ocr.Replace)
-	SetupTesseract()
+	if workers, err = NewPool(config.Value.Ocr.Engine, concurrency); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func GetText(buf []byte) (string, error) {
-	text, err := RunTesseract(buf)
-	if err != nil {
-		return "", err
+func Stop() {
+	if err := workers.Close(); err != nil {
+		log.Printf("unable to close ocr engine %q: %s", config.Value.Ocr.Engine, err.Error())
 	}
-	return replacer.Replace(text), nil
 }
 
-func pipeline(task pipelineTask) {
-	source, err := binarize.Load(task.name)
+func GetText(ctx context.Context, buf []byte) (Recognition, error) {
+	worker := workers.Get()
+	r, err := worker.Recognize(ctx, buf)
+	workers.Put(worker)
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("frame %s/%02d not exist, exitting", util.FormatDuration(task.time), task.frame)
-			task.tokens <- struct{}{}
-			task.stop <- struct{}{}
-			return
-		}
-		log.Fatal(err)
+		return Recognition{}, err
 	}
-	cropped := binarize.Crop(source.(binarize.SubImager))
-	binaried, index1 := binarize.Binarize(cropped)
-	optimized, index2 := binarize.Optimize(cropped, binaried, index1)
-	task.img = binarize.Trim(optimized, index2)
-	binarize.CoordPool.Put(index1)
-	binarize.CoordPool.Put(index2)
-	if task.img == nil {
-		task.status = "EMPTY"
-		task.nextChan <- task
-		task.result <- task
-		task.tokens <- struct{}{}
-		log.Printf(fmt.Sprintf("%s/%02d (EMPTY) idle=%3dms %q\n",
-			util.FormatDuration(task.time), task.frame, task.idle, task.text))
-		return
+	r.Text = replacer.Replace(r.Text)
+	return r, nil
+}
+
+// pageSegMode prefers the single line mode when lines are recognized one by one
+func pageSegMode() int {
+	if config.Value.Ocr.Lines.Split && config.Value.Ocr.Lines.Psm > 0 {
+		return config.Value.Ocr.Lines.Psm
 	}
-	task.status = "RESUL"
-	idleStart := time.Now()
-	prev := <-task.prevChan
-	task.idle += time.Since(idleStart).Milliseconds()
-	bound := cropped.Bounds()
-	cacheLimit := config.Value.Ocr.Cache.Calculate(bound.Dx() * bound.Dy())
-	if !config.Value.Ocr.Cache.Equal(0, 0) {
-		if binarize.Difference(prev.img, task.img) <= cacheLimit {
-			task.text = prev.text
-			task.nextChan <- task
-			task.result <- task
-			task.tokens <- struct{}{}
-			log.Printf(fmt.Sprintf("%s/%02d (CACHE) idle=%3dms %q\n",
-				util.FormatDuration(task.time), task.frame, task.idle, task.text))
-			return
+	return config.Value.Tesseract.Psm
+}
+
+// Inputs gives the images sent to the engine for a trimmed mask, one for
+// each line when lines are split
+func Inputs(img *image.Gray) []*image.Gray {
+	if !config.Value.Ocr.Lines.Split {
+		return []*image.Gray{binarize.Prepare(img)}
+	}
+	c := config.Value.Ocr.Lines
+	inputs := []*image.Gray{}
+	for _, l := range binarize.Lines(img, c.Gap, c.MinHeight) {
+		inputs = append(inputs, binarize.Prepare(binarize.TrimBox(img, l)))
+	}
+	return inputs
+}
+
+func Recognize(ctx context.Context, img *image.Gray) (Recognition, error) {
+	inputs := Inputs(img)
+	if !config.Value.Ocr.Lines.Split {
+		return recognize(ctx, inputs[0])
+	}
+	texts := []string{}
+	total, n := 0.0, 0
+	for _, in := range inputs {
+		r, err := recognize(ctx, in)
+		if err != nil {
+			return Recognition{}, err
+		}
+		if t := strings.TrimSpace(r.Text); len(t) > 0 {
+			texts = append(texts, t)
 		}
+		if r.Confidence >= 0 {
+			total += r.Confidence
+			n++
+		}
+	}
+	r := Recognition{Text: strings.Join(texts, "\n"), Confidence: -1}
+	if n > 0 {
+		r.Confidence = total / float64(n)
 	}
+	return r, nil
+}
+
+func recognize(ctx context.Context, img *image.Gray) (Recognition, error) {
 	buf := util.BufferPool.Get().(*bytes.Buffer)
+	defer util.BufferPool.Put(buf)
 	buf.Reset()
-	if binarize.Encode(buf, task.img, config.Value.Ocr.Format, config.Value.Ocr.JpgQuality); err != nil {
-		log.Print(err)
+	if err := binarize.Encode(buf, img, config.Value.Ocr.Format, config.Value.Ocr.JpgQuality); err != nil {
+		return Recognition{}, err
 	}
-	task.text, err = GetText(buf.Bytes())
-	util.BufferPool.Put(buf)
-	if err != nil {
-		log.Printf("failed to get text from %s: %s", task.name, err.Error())
+	return GetText(ctx, buf.Bytes())
+}
+
+func pipeline(task pipelineTask) {
+	var err error
+	source := task.source
+	task.source = nil
+	if source == nil {
+		if source, err = binarize.Load(task.name); err != nil {
+			log.Fatal(err)
+		}
+	}
+	task.regions = make([]regionResult, len(binarize.Regions))
+	empty := true
+	for i := range binarize.Regions {
+		e := binarize.Extract(source, &binarize.Regions[i].BinarizeConfig)
+		task.bounds = e.Frame
+		task.regions[i] = regionResult{img: e.Image, box: e.Text, crop: e.Crop, status: "EMPTY"}
+		if e.Image != nil {
+			task.regions[i].status = "RESUL"
+			empty = false
+		}
 	}
+	// the next frame only needs the masks to compare, so they are passed on
+	// before recognizing, and the text of a cached region is awaited only
+	// when this frame matches the previous one
+	task.recognized = make(chan struct{})
 	task.nextChan <- task
+	if !empty && !config.Value.Ocr.Cache.Equal(0, 0) {
+		idleStart := time.Now()
+		prev := <-task.prevChan
+		task.idle += time.Since(idleStart).Milliseconds()
+		waited := false
+		for i := range task.regions {
+			r := &task.regions[i]
+			if r.img == nil || i >= len(prev.regions) {
+				continue
+			}
+			cacheLimit := config.Value.Ocr.Cache.Calculate(r.crop.Dx() * r.crop.Dy())
+			if binarize.Difference(prev.regions[i].img, r.img) > cacheLimit {
+				continue
+			}
+			if !waited {
+				idleStart = time.Now()
+				<-prev.recognized
+				task.idle += time.Since(idleStart).Milliseconds()
+				waited = true
+			}
+			r.status = "CACHE"
+			r.text, r.conf = prev.regions[i].text, prev.regions[i].conf
+		}
+	}
+	for i := range task.regions {
+		r := &task.regions[i]
+		if r.status != "RESUL" {
+			continue
+		}
+		rec, err := Recognize(task.ctx, r.img)
+		if err != nil {
+			log.Printf("failed to get text at %s: %s", task.time, err.Error())
+			if task.ctx.Err() != nil {
+				r.status = "ABORT"
+			}
+		}
+		r.text, r.conf = rec.Text, rec.Confidence
+	}
+	close(task.recognized)
 	task.result <- task
 	task.tokens <- struct{}{}
-	log.Printf(fmt.Sprintf("%s/%02d (RESUL) idle=%3dms %q\n",
-		util.FormatDuration(task.time), task.frame, task.idle, task.text))
+	for i, r := range task.regions {
+		if name := binarize.Regions[i].Name; name != "" {
+			log.Printf("%s [%s] (%s) idle=%3dms %q\n", task.time, name, r.status, task.idle, r.text)
+		} else {
+			log.Printf("%s (%s) idle=%3dms %q\n", task.time, r.status, task.idle, r.text)
+		}
+	}
 }
 
 func Ocr(ctx *cli.Context) error {
-	Init()
+	concurrency := ctx.Int("concurrency")
+	Init(concurrency)
 	dir := ctx.String("dir")
 	begin := ctx.String("begin")
-	beginTime, err := util.ParseDuration(begin)
+	beginTime, err := util.ParseTimestamp(begin)
 	if err != nil {
 		log.Fatalf("unable to parse beginning time: %s", err.Error())
 	}
-	end := ctx.String("end")
-	endTime, err := util.ParseDuration(end)
-	if err != nil {
-		log.Fatalf("unable to parse endding time: %s", err.Error())
+	endTime := unbounded
+	if ctx.IsSet("end") {
+		if endTime, err = util.ParseTimestamp(ctx.String("end")); err != nil {
+			log.Fatalf("unable to parse endding time: %s", err.Error())
+		}
+	}
+	var m *manifest.Manifest
+	if manifest.Exists(dir) {
+		if m, err = manifest.Load(dir); err != nil {
+			log.Fatalf("unable to load manifest: %s", err.Error())
+		}
+		if err := m.Apply(ctx.Bool("strict")); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Printf("no %s in %s, frames are assumed to be sliced with current configuration", manifest.Filename, dir)
 	}
 	outputFilename := ctx.String("output")
+	cp, err := OpenCheckpoint(outputFilename+".checkpoint", ctx.Bool("resume"), len(binarize.Regions))
+	if err != nil {
+		log.Fatalf("unable to open checkpoint: %s", err.Error())
+	}
+	if cp.Len() > 0 {
+		log.Printf("resuming from checkpoint with %d frames processed", cp.Len())
+	}
 	outFile, err := os.Create(outputFilename)
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
+	defer outFile.Close()
 
+	all := make(chan Frame)
+	go listFrames(ctx.Context, dir, m, beginTime, endTime, all)
+	frames := make(chan Frame)
+	go skipFrames(ctx.Context, cp, all, frames)
+	Process(ctx.Context, frames, concurrency, outFile, cp)
+	Stop()
+	if ctx.Err() != nil {
+		log.Printf("checkpoint kept at %s, rerun with --resume to continue", outputFilename+".checkpoint")
+		return util.ErrInterrupted
+	}
+	if err := cp.Remove(); err != nil {
+		log.Printf("unable to remove checkpoint: %s", err.Error())
+	}
+	return nil
+}
+
+func skipFrames(ctx context.Context, cp *Checkpoint, all <-chan Frame, frames chan<- Frame) {
+	defer close(frames)
+	i := 0
+	for f := range all {
+		if i < cp.Len() {
+			if f.Time != cp.replay[i].time {
+				log.Fatalf("checkpoint does not match frames: expect frame at %s, got %s", cp.replay[i].time, f.Time)
+			}
+			i++
+			continue
+		}
+		select {
+		case frames <- f:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if i < cp.Len() && ctx.Err() == nil {
+		log.Fatalf("checkpoint does not match frames: %d frames in checkpoint, %d frames found", cp.Len(), i)
+	}
+}
+
+func listFrames(ctx context.Context, dir string, m *manifest.Manifest, beginTime, endTime util.Timestamp, frames chan<- Frame) {
+	defer close(frames)
+	if m != nil {
+		if m.Probe != nil {
+			log.Printf("frames sliced from %s to %s of %s video (%dx%d, %s fps)", m.Begin, m.End, m.Probe.Duration, m.Probe.Width, m.Probe.Height, m.Probe.FrameRate)
+		}
+		for i, f := range m.Frames {
+			if f.Time < beginTime || f.Time >= endTime {
+				continue
+			}
+			if _, err := os.Stat(path.Join(dir, f.Name)); err != nil {
+				log.Fatalf("frame %s listed in manifest is missing: %s", f.Time, err.Error())
+			}
+			end := m.End
+			if i+1 < len(m.Frames) {
+				end = m.Frames[i+1].Time
+			}
+			select {
+			case frames <- Frame{Name: path.Join(dir, f.Name), Time: f.Time, End: end}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		return
+	}
+	all, err := scanFrames(dir)
+	if err != nil {
+		log.Fatalf("unable to list frames: %s", err.Error())
+	}
+	for _, f := range all {
+		if f.Time < beginTime-beginTime%util.Second || f.Time >= endTime {
+			continue
+		}
+		select {
+		case frames <- f:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scanFrames lists the frames sliced into hXXmYY directories in time order,
+// so that a missing frame does not hide the ones after it
+func scanFrames(dir string) ([]Frame, error) {
+	subdirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	frames := []Frame{}
+	for _, sub := range subdirs {
+		if !sub.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(path.Join(dir, sub.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := path.Join(sub.Name(), f.Name())
+			t, fid, ok := util.ParseFramePath(name)
+			if !ok || fid%config.Value.Slice.FpsFactor != 0 || fid/config.Value.Slice.FpsFactor >= config.Value.Slice.Fps {
+				continue
+			}
+			ts := t + util.FrameDuration()*util.Timestamp(fid/config.Value.Slice.FpsFactor)
+			frames = append(frames, Frame{Name: path.Join(dir, name), Time: ts, End: ts + util.FrameDuration()})
+		}
+	}
+	sort.Slice(frames, func(i, j int) bool {
+		return frames[i].Time < frames[j].Time
+	})
+	return frames, nil
+}
+
+func Process(ctx context.Context, frames <-chan Frame, concurrency int, w io.Writer, cp *Checkpoint) {
 	result := make(chan pipelineTask)
 	done := make(chan struct{})
-	go writeResult(beginTime, outFile, result, done)
+	go writeResult(w, cp, result, done)
 
-	concurrency := ctx.Int("concurrency")
 	token := make(chan struct{}, concurrency)
-	stop := make(chan struct{})
 	for i := 0; i < concurrency; i++ {
 		token <- struct{}{}
 	}
@@ -141,108 +388,152 @@ func Ocr(ctx *cli.Context) error {
 	var prevChan, nextChan chan pipelineTask
 	nextChan = make(chan pipelineTask, 1)
 	nextChan <- pipelineTask{}
-	for t := beginTime; t < endTime; t += time.Second * time.Duration(config.Value.Slice.FrameInterval) {
-		pathname := path.Join(dir, fmt.Sprintf("h%02dm%02d", int(t.Hours()), int(t.Minutes())%60))
-		for fidB := 0; fidB < config.Value.Slice.Fps; fidB++ {
-			fid := fidB * config.Value.Slice.FpsFactor
-
-			prevChan = nextChan
-			nextChan = make(chan pipelineTask, 1)
-
-			idleStart := time.Now()
-			select {
-			case <-stop:
-				goto finish
-			case <-token:
-			}
+	seq := cp.Len()
+	for f := range frames {
+		if ctx.Err() != nil {
+			log.Print("stop dispatching frames, waiting for in-flight ones")
+			break
+		}
+		prevChan = nextChan
+		nextChan = make(chan pipelineTask, 1)
 
-			filename := fmt.Sprintf("s%02df%02d.%s", int(t.Seconds())%60, fid, config.Value.Slice.Format)
-			go pipeline(pipelineTask{
-				name:     path.Join(pathname, filename),
-				time:     t,
-				frame:    fid,
-				idle:     time.Since(idleStart).Milliseconds(),
-				prevChan: prevChan,
-				nextChan: nextChan,
-				tokens:   token,
-				stop:     stop,
-				result:   result,
-			})
+		idleStart := time.Now()
+		<-token
 
-		}
+		go pipeline(pipelineTask{
+			seq:      seq,
+			name:     f.Name,
+			time:     f.Time,
+			end:      f.End,
+			source:   f.Image,
+			idle:     time.Since(idleStart).Milliseconds(),
+			ctx:      ctx,
+			prevChan: prevChan,
+			nextChan: nextChan,
+			tokens:   token,
+			result:   result,
+		})
+		seq++
 	}
-finish:
 	for i := 0; i < concurrency; i++ {
 		<-token
 	}
 	close(result)
 	<-done
-	StopTesseract()
-	return nil
 }
 
-func writeResult(begin time.Duration, file *os.File, ch <-chan pipelineTask, done chan<- struct{}) {
-	initted := false
-	start, last := pipelineTask{}, pipelineTask{}
+func (task pipelineTask) record(i int) result.Record {
+	r := task.regions[i]
+	return result.Record{
+		Begin:      task.time,
+		Text:       r.text,
+		Box:        r.box,
+		Frame:      task.bounds,
+		Confidence: r.conf,
+		Engine:     config.Value.Ocr.Engine,
+		Track:      binarize.Regions[i].Name,
+	}
+}
 
-	buf := make(map[int]pipelineTask)
-	counter := 0
+func (task pipelineTask) aborted() bool {
+	for _, r := range task.regions {
+		if r.status == "ABORT" {
+			return true
+		}
+	}
+	return false
+}
 
-	expectTime := begin
-	expectFrame := 0
+func writeResult(file io.Writer, cp *Checkpoint, ch <-chan pipelineTask, done chan<- struct{}) {
+	w, err := result.NewWriter(file, config.Value.Ocr.Results)
+	if err != nil {
+		log.Fatal(err)
+	}
+	type span struct {
+		start regionResult
+		rec   result.Record
+	}
+	initted := false
+	spans := make([]span, len(binarize.Regions))
+	last := pipelineTask{}
+	flush := func(s *span, end util.Timestamp) {
+		if len(s.start.text) == 0 {
+			return
+		}
+		s.rec.End = end
+		if err := w.Write(s.rec); err != nil {
+			log.Fatalf("unable to write result: %s", err.Error())
+		}
+	}
 
-	for recevied := range ch {
-		buf[counter] = recevied
-		counter++
-
-		found := true
-		for found {
-			found = false
-			for index, item := range buf {
-				if item.time == expectTime && item.frame == expectFrame {
-					found = true
-					delete(buf, index)
-					expectFrame += config.Value.Slice.FpsFactor
-					if expectFrame == config.Value.Slice.Fps*config.Value.Slice.FpsFactor {
-						expectTime += time.Second * time.Duration(config.Value.Slice.FrameInterval)
-						expectFrame = 0
-					}
+	buf := make(map[int]pipelineTask)
+	expect := 0
+	aborted := false
+	drain := func() {
+		for {
+			item, ok := buf[expect]
+			if !ok {
+				break
+			}
+			delete(buf, expect)
+			expect++
+			if item.aborted() {
+				aborted = true
+			}
+			if aborted {
+				continue
+			}
+			if item.seq >= cp.Len() {
+				if err := cp.append(item); err != nil {
+					log.Fatalf("unable to write checkpoint: %s", err.Error())
+				}
+			}
 
-					if start.text != item.text || start.status != item.status {
-						if !initted {
-							initted = true
-						} else if len(start.text) > 0 {
-							fmt.Fprintf(file, "%s/%02d->%s/%02d %q\n",
-								util.FormatDuration(start.time), start.frame,
-								util.FormatDuration(last.time), last.frame,
-								start.text,
-							)
-						}
-						start = item
-					}
-					last = item
-					last.frame += config.Value.Slice.FpsFactor
-					if last.frame == config.Value.Slice.Fps*config.Value.Slice.FpsFactor {
-						last.time += time.Second * time.Duration(config.Value.Slice.FrameInterval)
-						last.frame = 0
+			for i, r := range item.regions {
+				s := &spans[i]
+				// a cached result continues the span of the frame it was copied from
+				if r.status == "CACHE" {
+					r.status = "RESUL"
+				}
+				if !initted || s.start.text != r.text || s.start.status != r.status {
+					if initted {
+						flush(s, item.time)
 					}
-					break
+					s.start = r
+					s.rec = item.record(i)
+				}
+				s.rec.Frames++
+				if len(item.name) > 0 {
+					s.rec.Sources = append(s.rec.Sources, item.name)
 				}
 			}
+			initted = true
+			last = item
 		}
+	}
 
+	if cp != nil {
+		for _, item := range cp.replay {
+			buf[item.seq] = item
+		}
+		drain()
+	}
+	for recevied := range ch {
+		buf[recevied.seq] = recevied
+		drain()
 	}
 
 	if len(buf) > 0 {
 		panic("still item in buf")
 	}
 
-	if initted && len(start.text) > 0 {
-		fmt.Fprintf(file, "%s/%02d->%s/%02d %q\n",
-			util.FormatDuration(start.time), start.frame,
-			util.FormatDuration(last.time), last.frame,
-			start.text,
-		)
+	if aborted {
+		log.Printf("results after %s are discarded due to interruption", last.end)
+	}
+	if initted {
+		for i := range spans {
+			flush(&spans[i], last.end)
+		}
 	}
 	done <- struct{}{}
 }
@@ -0,0 +1,189 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piggynl/subtitle/binarize"
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/result"
+	"github.com/piggynl/subtitle/util"
+)
+
+// slowEngine takes a while on every image and records how many images are
+// recognized at the same time
+type slowEngine struct {
+	fakeEngine
+	running, peak *int32
+}
+
+func init() {
+	var running, peak int32
+	Register("slow", func() Engine {
+		return slowEngine{running: &running, peak: &peak}
+	})
+}
+
+func (e slowEngine) Recognize(ctx context.Context, image []byte) (Recognition, error) {
+	n := atomic.AddInt32(e.running, 1)
+	defer atomic.AddInt32(e.running, -1)
+	for {
+		p := atomic.LoadInt32(e.peak)
+		if n <= p || atomic.CompareAndSwapInt32(e.peak, p, n) {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	return e.fakeEngine.Recognize(ctx, image)
+}
+
+func setup() {
+	setupEngine("fake", 2)
+}
+
+func setupEngine(engine string, concurrency int) {
+	config.Reset(nil)
+	config.Value.Ocr.Engine = engine
+	config.Value.Ocr.Format = "png"
+	config.Value.Slice.Format = "png"
+	config.Value.Binarize.TextColors = []config.ColorGroup{config.MustNewColorGroup("#ffffff/8")}
+	Init(concurrency)
+}
+
+// textFrame draws white boxes standing for lines of text on black
+func textFrame(lines ...image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 160, 90))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for _, l := range lines {
+		draw.Draw(img, l, image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+func expected(t *testing.T, img image.Image) string {
+	e := binarize.Extract(img, &binarize.Regions[0].BinarizeConfig)
+	r, err := Recognize(context.Background(), e.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Text
+}
+
+func TestProcess(t *testing.T) {
+	setup()
+	defer Stop()
+	dir, err := ioutil.TempDir("", "subtitle-ocr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := textFrame(image.Rect(40, 60, 120, 75))
+	second := textFrame(image.Rect(30, 50, 130, 60), image.Rect(50, 65, 110, 75))
+	// the frame at 6s is missing, which must not end the listing
+	frames := []image.Image{first, first, textFrame(), second, second, textFrame(), nil, first}
+	for i, img := range frames {
+		if img == nil {
+			continue
+		}
+		name := path.Join(dir, util.FramePath(util.Second*util.Timestamp(i), 0))
+		if err := os.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := binarize.Save(name, img, "png", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan Frame)
+	go listFrames(context.Background(), dir, nil, 0, unbounded, ch)
+	out := &bytes.Buffer{}
+	Process(context.Background(), ch, 2, out, nil)
+
+	want := []result.Record{
+		{Begin: 0, End: 2 * util.Second, Text: expected(t, first), Frames: 2},
+		{Begin: 3 * util.Second, End: 5 * util.Second, Text: expected(t, second), Frames: 2},
+		{Begin: 7 * util.Second, End: 8 * util.Second, Text: expected(t, first), Frames: 1},
+	}
+	r := result.NewReader(out)
+	for i, w := range want {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: %s", i, err.Error())
+		}
+		if !strings.HasPrefix(got.Text, "fake-") {
+			t.Errorf("record %d: text %q is not from the fake engine", i, got.Text)
+		}
+		if got.Begin != w.Begin || got.End != w.End || got.Text != w.Text || got.Frames != w.Frames {
+			t.Errorf("record %d = %s (%d frames), want %s (%d frames)", i, got, got.Frames, w, w.Frames)
+		}
+		if got.Engine != "fake" || got.Confidence != 100 || len(got.Sources) != got.Frames {
+			t.Errorf("record %d: engine %q, confidence %v, %d sources", i, got.Engine, got.Confidence, len(got.Sources))
+		}
+	}
+	if got, err := r.Read(); err != io.EOF {
+		t.Errorf("unexpected record %s, error %v", got, err)
+	}
+}
+
+func TestRecognizeLines(t *testing.T) {
+	setup()
+	defer Stop()
+	config.Value.Ocr.Lines.Split = true
+	img := textFrame(image.Rect(30, 50, 130, 60), image.Rect(50, 65, 110, 75))
+	e := binarize.Extract(img, &binarize.Regions[0].BinarizeConfig)
+	r, err := Recognize(context.Background(), e.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(r.Text, "\n")
+	if len(lines) != 2 || lines[0] == lines[1] {
+		t.Fatalf("Recognize() = %q, want two different lines", r.Text)
+	}
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "fake-") {
+			t.Errorf("line %q is not from the fake engine", l)
+		}
+	}
+}
+
+func TestProcessConcurrency(t *testing.T) {
+	for _, cache := range []string{"0%+0", "1%+0"} {
+		setupEngine("slow", 4)
+		config.Value.Ocr.Cache = config.MustNewRelativeValue(cache)
+		e, _ := NewEngine("slow")
+		peak := e.(slowEngine).peak
+		atomic.StoreInt32(peak, 0)
+
+		ch := make(chan Frame)
+		go func() {
+			for i := 0; i < 8; i++ {
+				// every frame differs from the previous one, so nothing is cached
+				img := textFrame(image.Rect(20, 60, 60+i*10, 75))
+				ch <- Frame{Time: util.Second * util.Timestamp(i), End: util.Second * util.Timestamp(i+1), Image: img}
+			}
+			close(ch)
+		}()
+		out := &bytes.Buffer{}
+		Process(context.Background(), ch, 4, out, nil)
+		Stop()
+
+		if p := atomic.LoadInt32(peak); p < 2 {
+			t.Errorf("cache %s: at most %d images recognized at the same time with 4 workers", cache, p)
+		}
+		if n := strings.Count(out.String(), "\n"); n != 8 {
+			t.Errorf("cache %s: %d records, want 8", cache, n)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ocr
+
+import (
+	"fmt"
+)
+
+type Pool struct {
+	workers chan Engine
+	engines []Engine
+}
+
+func NewPool(name string, size int) (*Pool, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("invalid ocr worker count %d", size)
+	}
+	p := &Pool{workers: make(chan Engine, size)}
+	for i := 0; i < size; i++ {
+		if i > 0 && p.engines[0].Capabilities().Concurrent {
+			p.workers <- p.engines[0]
+			continue
+		}
+		e, err := NewEngine(name)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		if err := e.Setup(); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("unable to setup ocr engine %q: %w", name, err)
+		}
+		p.engines = append(p.engines, e)
+		p.workers <- e
+	}
+	return p, nil
+}
+
+func (p *Pool) Get() Engine {
+	return <-p.workers
+}
+
+func (p *Pool) Put(e Engine) {
+	p.workers <- e
+}
+
+func (p *Pool) Size() int {
+	return cap(p.workers)
+}
+
+func (p *Pool) Close() error {
+	var first error
+	for _, e := range p.engines {
+		if err := e.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	p.engines = nil
+	return first
+}
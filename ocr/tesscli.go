@@ -1,77 +1,117 @@
-//go:build !gosseract
-// +build !gosseract
-
 package ocr
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"log"
 	"os/exec"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/piggynl/subtitle/config"
 	"github.com/piggynl/subtitle/util"
 )
 
-const VersionTag = ""
+// tessCli runs one tesseract process per image, as the command line reads a
+// single image from stdin and exits, so one engine is shared by all workers
+// of the pool and --concurrency only bounds the processes running at once,
+// long-lived workers are left to the gosseract engine
+type tessCli struct {
+	args []string
+}
 
-var lock sync.Mutex
-var args []string
+func init() {
+	Register("tesseract", func() Engine {
+		return new(tessCli)
+	})
+}
 
-func SetupTesseract() {
-	args = []string{
+func (e *tessCli) Setup() error {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return fmt.Errorf("unable to find tesseract: %w", err)
+	}
+	e.args = []string{
 		"stdin", "stdout",
 		"-l", strings.Join(config.Value.Tesseract.Langs, "+"),
-		"--psm", strconv.Itoa(config.Value.Tesseract.Psm),
+		"--psm", strconv.Itoa(pageSegMode()),
+		"tsv",
 	}
+	return nil
 }
 
-func StopTesseract() {
-	// no-op
+func (e *tessCli) Close() error {
+	return nil
 }
 
-func RunTesseract(image []byte) (string, error) {
-	lock.Lock()
-	defer lock.Unlock()
-	cmd := exec.Command("tesseract", args...)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return "", fmt.Errorf("unable to get stdin pipe: %w", err)
-	}
-	if _, err := stdin.Write(image); err != nil {
-		return "", fmt.Errorf("unable to write image to stdin pipe: %w", err)
-	}
-	if err := stdin.Close(); err != nil {
-		return "", fmt.Errorf("unable to close stdin pipe: %w", err)
+func (e *tessCli) Capabilities() Capabilities {
+	return Capabilities{Concurrent: true, Confidence: true}
+}
+
+func parseTsv(tsv string) (Recognition, error) {
+	text := &strings.Builder{}
+	total, words := 0.0, 0
+	var block, par, line string
+	for i, l := range strings.Split(tsv, "\n") {
+		fields := strings.Split(l, "\t")
+		if i == 0 || len(fields) < 12 || fields[0] != "5" {
+			continue
+		}
+		if text.Len() > 0 {
+			switch {
+			case fields[2] != block || fields[3] != par:
+				text.WriteString("\n\n")
+			case fields[4] != line:
+				text.WriteString("\n")
+			default:
+				text.WriteString(" ")
+			}
+		}
+		block, par, line = fields[2], fields[3], fields[4]
+		text.WriteString(fields[11])
+		conf, err := strconv.ParseFloat(fields[10], 64)
+		if err != nil {
+			return Recognition{}, fmt.Errorf("malformed confidence %q in tesseract output", fields[10])
+		}
+		if conf >= 0 {
+			total += conf
+			words++
+		}
 	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", fmt.Errorf("unable to get stderr pipe: %w", err)
+	r := Recognition{Text: text.String(), Confidence: -1}
+	if text.Len() > 0 {
+		r.Text += "\n"
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return "", fmt.Errorf("unable to get stderr pipe: %w", err)
+	if words > 0 {
+		r.Confidence = total / float64(words)
 	}
+	return r, nil
+}
+
+func (e *tessCli) Recognize(ctx context.Context, image []byte) (Recognition, error) {
 	stdoutBuf := util.BufferPool.Get().(*bytes.Buffer)
 	stderrBuf := util.BufferPool.Get().(*bytes.Buffer)
+	defer util.BufferPool.Put(stdoutBuf)
+	defer util.BufferPool.Put(stderrBuf)
 	stdoutBuf.Reset()
 	stderrBuf.Reset()
-	go io.Copy(stdoutBuf, stdout)
-	go io.Copy(stderrBuf, stderr)
-	if err := cmd.Run(); err != nil {
+	cmd := exec.CommandContext(ctx, "tesseract", e.args...)
+	cmd.Stdin = bytes.NewReader(image)
+	cmd.Stdout = stdoutBuf
+	cmd.Stderr = stderrBuf
+	if err := util.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return Recognition{}, ctx.Err()
+		}
 		log.Printf("error occurs while running tesseract: %s", err.Error())
 		log.Print("stderr of tesseract is shown below:")
 		fmt.Println(string(stderrBuf.Bytes()))
-		return "", fmt.Errorf("error occurs while running tesseract: %w", err)
+		return Recognition{}, fmt.Errorf("error occurs while running tesseract: %w", err)
 	}
 	if stderrBuf.Len() > 0 {
 		log.Print("stderr from tesseract is not empty")
 		log.Print("stderr of tesseract is shown below:")
 		fmt.Println(string(stderrBuf.Bytes()))
 	}
-	return string(stdoutBuf.Bytes()), nil
+	return parseTsv(string(stdoutBuf.Bytes()))
 }
@@ -0,0 +1,73 @@
+package result
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Writer struct {
+	w      io.Writer
+	format string
+}
+
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case "raw", "jsonl":
+	default:
+		return nil, fmt.Errorf("unsupported result format %q", format)
+	}
+	return &Writer{w, format}, nil
+}
+
+func (w *Writer) Write(r Record) error {
+	if w.format == "raw" {
+		_, err := fmt.Fprintln(w.w, r)
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.w, "%s\n", b)
+	return err
+}
+
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+func (r *Reader) Read() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		l := strings.TrimSpace(r.scanner.Text())
+		if len(l) == 0 {
+			continue
+		}
+		var x Record
+		var err error
+		if strings.HasPrefix(l, "{") {
+			err = json.Unmarshal([]byte(l), &x)
+		} else {
+			x, err = Parse(l)
+			x.Confidence = -1
+		}
+		if err != nil {
+			return x, fmt.Errorf("failed to parse line %d: %w", r.line, err)
+		}
+		return x, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
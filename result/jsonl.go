@@ -0,0 +1,76 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+
+	"github.com/piggynl/subtitle/util"
+)
+
+const Version = 1
+
+type jsonRecord struct {
+	Version    int            `json:"version"`
+	Begin      util.Timestamp `json:"begin"`
+	End        util.Timestamp `json:"end"`
+	Text       string         `json:"text"`
+	Frames     int            `json:"frames,omitempty"`
+	Confidence *float64       `json:"confidence,omitempty"`
+	Box        *[4]int        `json:"box,omitempty"`
+	Frame      *[2]int        `json:"frame,omitempty"`
+	Engine     string         `json:"engine,omitempty"`
+	Sources    []string       `json:"sources,omitempty"`
+	Track      string         `json:"track,omitempty"`
+}
+
+func (r Record) MarshalJSON() ([]byte, error) {
+	j := jsonRecord{
+		Version: Version,
+		Begin:   r.Begin,
+		End:     r.End,
+		Text:    r.Text,
+		Frames:  r.Frames,
+		Engine:  r.Engine,
+		Sources: r.Sources,
+		Track:   r.Track,
+	}
+	if r.Confidence >= 0 {
+		j.Confidence = &r.Confidence
+	}
+	if !r.Box.Empty() {
+		j.Box = &[4]int{r.Box.Min.X, r.Box.Min.Y, r.Box.Max.X, r.Box.Max.Y}
+		j.Frame = &[2]int{r.Frame.Dx(), r.Frame.Dy()}
+	}
+	return json.Marshal(j)
+}
+
+func (r *Record) UnmarshalJSON(b []byte) error {
+	j := jsonRecord{}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j.Version > Version {
+		return fmt.Errorf("unsupported result version %d", j.Version)
+	}
+	*r = Record{
+		Begin:      j.Begin,
+		End:        j.End,
+		Text:       j.Text,
+		Frames:     j.Frames,
+		Confidence: -1,
+		Engine:     j.Engine,
+		Sources:    j.Sources,
+		Track:      j.Track,
+	}
+	if j.Confidence != nil {
+		r.Confidence = *j.Confidence
+	}
+	if j.Box != nil {
+		r.Box = image.Rect(j.Box[0], j.Box[1], j.Box[2], j.Box[3])
+	}
+	if j.Frame != nil {
+		r.Frame = image.Rect(0, 0, j.Frame[0], j.Frame[1])
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package result
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/util"
+)
+
+type Record struct {
+	Begin, End util.Timestamp
+	Text       string
+	Box        image.Rectangle
+	Frame      image.Rectangle
+	Frames     int
+	Confidence float64
+	Engine     string
+	Sources    []string
+	Track      string
+}
+
+func (r Record) String() string {
+	s := fmt.Sprintf("%s->%s %q", r.Begin, r.End, r.Text)
+	if !r.Box.Empty() {
+		s += fmt.Sprintf(" %d,%d,%d,%d %dx%d",
+			r.Box.Min.X, r.Box.Min.Y, r.Box.Max.X, r.Box.Max.Y,
+			r.Frame.Dx(), r.Frame.Dy(),
+		)
+	}
+	if len(r.Track) > 0 {
+		s = fmt.Sprintf("[%s] %s", r.Track, s)
+	}
+	return s
+}
+
+func (r *Record) Merge(x Record) {
+	if r.Frames+x.Frames > 0 {
+		r.Confidence = (r.Confidence*float64(r.Frames) + x.Confidence*float64(x.Frames)) / float64(r.Frames+x.Frames)
+	}
+	r.End = x.End
+	r.Frames += x.Frames
+	r.Sources = append(r.Sources, x.Sources...)
+}
+
+func parseTime(s string) (util.Timestamp, error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return util.ParseTimestamp(s)
+	}
+	t, err := util.ParseTimestamp(s[:i])
+	if err != nil {
+		return 0, err
+	}
+	var f int
+	if _, err := fmt.Sscanf(s[i+1:], "%02d", &f); err != nil {
+		return 0, fmt.Errorf("unable to parse frame of %s: %w", s, err)
+	}
+	return t + util.Second*util.Timestamp(f)/util.Timestamp(config.Value.Slice.Fps*config.Value.Slice.FpsFactor), nil
+}
+
+func Parse(l string) (Record, error) {
+	r := Record{}
+	if strings.HasPrefix(l, "[") {
+		i := strings.Index(l, "] ")
+		if i < 0 {
+			return r, fmt.Errorf("malformed track %q", l)
+		}
+		r.Track, l = l[1:i], l[i+2:]
+	}
+	i := strings.IndexByte(l, ' ')
+	if i < 0 {
+		return r, fmt.Errorf("missing text")
+	}
+	times := strings.SplitN(l[:i], "->", 2)
+	if len(times) != 2 {
+		return r, fmt.Errorf("malformed time range %q", l[:i])
+	}
+	var err error
+	if r.Begin, err = parseTime(times[0]); err != nil {
+		return r, err
+	}
+	if r.End, err = parseTime(times[1]); err != nil {
+		return r, err
+	}
+	rest := strings.NewReader(l[i+1:])
+	if _, err := fmt.Fscanf(rest, "%q", &r.Text); err != nil {
+		return r, fmt.Errorf("malformed text: %w", err)
+	}
+	if rest.Len() == 0 {
+		return r, nil
+	}
+	var w, h int
+	if _, err := fmt.Fscanf(rest, " %d,%d,%d,%d %dx%d",
+		&r.Box.Min.X, &r.Box.Min.Y, &r.Box.Max.X, &r.Box.Max.Y, &w, &h,
+	); err != nil && err != io.EOF {
+		return r, fmt.Errorf("malformed text region: %w", err)
+	}
+	r.Frame = image.Rect(0, 0, w, h)
+	return r, nil
+}
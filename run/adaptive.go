@@ -0,0 +1,142 @@
+package run
+
+import (
+	"image"
+	"io"
+	"log"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/piggynl/subtitle/binarize"
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/ocr"
+	"github.com/piggynl/subtitle/result"
+	"github.com/piggynl/subtitle/slice"
+	"github.com/piggynl/subtitle/util"
+)
+
+type sample struct {
+	time util.Timestamp
+	binarize.Extraction
+}
+
+type adaptive struct {
+	ctx    *cli.Context
+	w      *result.Writer
+	region *config.Region
+	limit  int
+	seeks  int
+	start  sample
+}
+
+func runAdaptive(ctx *cli.Context, w io.Writer) {
+	rw, err := result.NewWriter(w, config.Value.Ocr.Results)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// each region bisects its own boundaries over the same sparse samples
+	as := make([]*adaptive, len(binarize.Regions))
+	for i := range as {
+		as[i] = &adaptive{ctx: ctx, w: rw, region: &binarize.Regions[i]}
+	}
+	frames := make(chan slice.Frame)
+	go slice.Stream(ctx, config.Value.Adaptive.Rate, frames)
+	prev := make([]sample, len(as))
+	var spacing util.Timestamp
+	count := 0
+	for f := range frames {
+		if ctx.Err() != nil {
+			break
+		}
+		for i, a := range as {
+			cur := a.sample(f)
+			if count == 0 {
+				a.limit = config.Value.Adaptive.Threshold.Calculate(cur.Crop.Dx() * cur.Crop.Dy())
+				a.start = cur
+			} else {
+				spacing = cur.time - prev[i].time
+				if !a.same(prev[i].Image, cur.Image) {
+					a.refine(prev[i], cur)
+				}
+			}
+			prev[i] = cur
+		}
+		count++
+	}
+	seeks := 0
+	for i, a := range as {
+		if ctx.Err() != nil {
+			a.emit(prev[i].time)
+		} else if count > 0 {
+			a.emit(prev[i].time + spacing)
+		}
+		seeks += a.seeks
+	}
+	log.Printf("adaptive sampling finished: %d samples, %d seeks", count, seeks)
+}
+
+func (a *adaptive) sample(f slice.Frame) sample {
+	return sample{f.Time, binarize.Extract(f.Image, &a.region.BinarizeConfig)}
+}
+
+func (a *adaptive) same(x, y *image.Gray) bool {
+	if x == nil || y == nil {
+		return x == nil && y == nil
+	}
+	return binarize.Difference(x, y) <= a.limit
+}
+
+func (a *adaptive) refine(l, r sample) {
+	if a.ctx.Err() != nil {
+		return
+	}
+	if r.time-l.time <= util.Timestamp(config.Value.Adaptive.Precision) {
+		a.boundary(r)
+		return
+	}
+	a.seeks++
+	f, ok := slice.Grab(a.ctx, l.time+(r.time-l.time)/2)
+	if !ok || f.Time <= l.time || f.Time >= r.time {
+		a.boundary(r)
+		return
+	}
+	m := a.sample(f)
+	switch {
+	case a.same(l.Image, m.Image):
+		a.refine(m, r)
+	case a.same(m.Image, r.Image):
+		a.refine(l, m)
+	default:
+		a.refine(l, m)
+		a.refine(m, r)
+	}
+}
+
+func (a *adaptive) boundary(s sample) {
+	a.emit(s.time)
+	a.start = s
+}
+
+func (a *adaptive) emit(end util.Timestamp) {
+	if a.start.Image == nil {
+		return
+	}
+	rec, err := ocr.Recognize(a.ctx.Context, a.start.Image)
+	if err != nil {
+		log.Printf("failed to get text at %s: %s", a.start.time, err.Error())
+	}
+	r := result.Record{
+		Begin:      a.start.time,
+		End:        end,
+		Text:       rec.Text,
+		Box:        a.start.Text,
+		Frame:      a.start.Frame,
+		Confidence: rec.Confidence,
+		Engine:     config.Value.Ocr.Engine,
+		Track:      a.region.Name,
+	}
+	log.Print(r)
+	if err := a.w.Write(r); err != nil {
+		log.Fatalf("unable to write result: %s", err.Error())
+	}
+}
@@ -0,0 +1,63 @@
+package run
+
+import (
+	"context"
+	"io"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/piggynl/subtitle/conv"
+	"github.com/piggynl/subtitle/ocr"
+	"github.com/piggynl/subtitle/slice"
+	"github.com/piggynl/subtitle/util"
+)
+
+func Run(ctx *cli.Context) error {
+	concurrency := ctx.Int("concurrency")
+	ocr.Init(concurrency)
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		conv.Run(r, ctx.String("output"))
+		close(done)
+	}()
+	if ctx.Bool("adaptive") {
+		runAdaptive(ctx, w)
+	} else {
+		images := make(chan slice.Frame, concurrency)
+		go slice.Stream(ctx, slice.Rate(), images)
+		frames := make(chan ocr.Frame)
+		go numberFrames(ctx.Context, images, frames)
+		ocr.Process(ctx.Context, frames, concurrency, w, nil)
+	}
+	w.Close()
+	<-done
+	ocr.Stop()
+	if ctx.Err() != nil {
+		return util.ErrInterrupted
+	}
+	return nil
+}
+
+func numberFrames(ctx context.Context, images <-chan slice.Frame, frames chan<- ocr.Frame) {
+	defer close(frames)
+	var prev *ocr.Frame
+	for img := range images {
+		if prev != nil {
+			prev.End = img.Time
+			select {
+			case frames <- *prev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		prev = &ocr.Frame{
+			Time:  img.Time,
+			Image: img.Image,
+		}
+	}
+	if prev != nil && ctx.Err() == nil {
+		prev.End = prev.Time + util.FrameDuration()
+		frames <- *prev
+	}
+}
@@ -0,0 +1,151 @@
+package slice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/piggynl/subtitle/binarize"
+	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/manifest"
+	"github.com/piggynl/subtitle/util"
+)
+
+type probeOutput struct {
+	Streams []struct {
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		RFrameRate   string `json:"r_frame_rate"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+func Probe(input string) (*manifest.Probe, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "format=duration:stream=codec_name,width,height,r_frame_rate,avg_frame_rate",
+		"-of", "json",
+		input,
+	)
+	stdoutBuf := &bytes.Buffer{}
+	stderrBuf := &bytes.Buffer{}
+	cmd.Stdout = stdoutBuf
+	cmd.Stderr = stderrBuf
+	if err := util.Run(cmd); err != nil {
+		return nil, fmt.Errorf("error occurs while running ffprobe: %w: %s", err, bytes.TrimSpace(stderrBuf.Bytes()))
+	}
+	out := probeOutput{}
+	if err := json.Unmarshal(stdoutBuf.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("unable to parse output of ffprobe: %w", err)
+	}
+	if len(out.Streams) == 0 {
+		return nil, fmt.Errorf("no video stream found in %q", input)
+	}
+	duration, err := strconv.ParseFloat(out.Format.Duration, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized duration %q reported by ffprobe", out.Format.Duration)
+	}
+	s := out.Streams[0]
+	p := &manifest.Probe{
+		Duration:  util.SecondsTimestamp(duration),
+		FrameRate: s.AvgFrameRate,
+		Codec:     s.CodecName,
+		Width:     s.Width,
+		Height:    s.Height,
+	}
+	if p.FrameRate == "" || p.FrameRate == "0/0" {
+		p.FrameRate = s.RFrameRate
+	}
+	return p, nil
+}
+
+var probed struct {
+	sync.Once
+	probe *manifest.Probe
+	err   error
+}
+
+func probeInput(input string) (*manifest.Probe, error) {
+	probed.Do(func() {
+		probed.probe, probed.err = Probe(input)
+		if probed.err == nil {
+			p := probed.probe
+			log.Printf("probed input: %s, %dx%d, %s fps, duration %s", p.Codec, p.Width, p.Height, p.FrameRate, p.Duration)
+		}
+	})
+	return probed.probe, probed.err
+}
+
+func cropArea(ctx *cli.Context) *manifest.Crop {
+	if !config.Value.Slice.Crop {
+		return nil
+	}
+	probe, err := probeInput(ctx.String("input"))
+	if err != nil {
+		log.Fatalf("unable to crop in ffmpeg without knowing the frame size: %s", err.Error())
+	}
+	regions, err := config.Value.Binarize.Resolve()
+	if err != nil {
+		log.Fatalf("invalid binarize.regions: %s", err.Error())
+	}
+	frame := image.Rect(0, 0, probe.Width, probe.Height)
+	r := binarize.CropUnion(frame, regions).Intersect(frame)
+	if r.Empty() {
+		log.Fatalf("binarize.crop is empty on %dx%d frames", probe.Width, probe.Height)
+	}
+	binarize.SetCanvas(frame, r.Min)
+	return &manifest.Crop{
+		X:           r.Min.X,
+		Y:           r.Min.Y,
+		Width:       r.Dx(),
+		Height:      r.Dy(),
+		FrameWidth:  frame.Dx(),
+		FrameHeight: frame.Dy(),
+	}
+}
+
+func filters(crop *manifest.Crop) []string {
+	vf := []string{}
+	if crop != nil {
+		vf = append(vf, fmt.Sprintf("crop=%d:%d:%d:%d", crop.Width, crop.Height, crop.X, crop.Y))
+	}
+	vf = append(vf, config.Value.Ffmpeg.Filters...)
+	return append(vf, "showinfo")
+}
+
+func resolveRange(ctx *cli.Context) (util.Timestamp, util.Timestamp, *manifest.Probe) {
+	begin, err := util.ParseTimestamp(ctx.String("begin"))
+	if err != nil {
+		log.Fatalf("unable to parse beginning time: %s", err.Error())
+	}
+	probe, err := probeInput(ctx.String("input"))
+	if err != nil {
+		if !ctx.IsSet("end") {
+			log.Fatalf("unable to detect the duration of input, specify --end explicitly: %s", err.Error())
+		}
+		log.Printf("unable to probe input: %s", err.Error())
+	}
+	if !ctx.IsSet("end") {
+		return begin, probe.Duration, probe
+	}
+	end, err := util.ParseTimestamp(ctx.String("end"))
+	if err != nil {
+		log.Fatalf("unable to parse endding time: %s", err.Error())
+	}
+	if probe != nil && end > probe.Duration {
+		end = probe.Duration
+	}
+	return begin, end, probe
+}
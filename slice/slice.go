@@ -3,111 +3,307 @@ package slice
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"image"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/urfave/cli/v2"
 
+	"github.com/piggynl/subtitle/binarize"
 	"github.com/piggynl/subtitle/config"
+	"github.com/piggynl/subtitle/manifest"
 	"github.com/piggynl/subtitle/util"
 )
 
-func makeArgs(ctx *cli.Context) []string {
-	vf := []string{fmt.Sprintf("fps=%d/%d", config.Value.Slice.Fps, config.Value.Slice.FrameInterval)}
-	vf = append(vf, config.Value.Ffmpeg.Filters...)
+type Frame struct {
+	Image image.Image
+	Time  util.Timestamp
+}
+
+var showinfoPattern = regexp.MustCompile(`\bn:\s*(\d+)\s+pts:\s*-?\d+\s+pts_time:\s*(-?[0-9.]+)`)
+
+func Rate() string {
+	return fmt.Sprintf("%d/%d", config.Value.Slice.Fps, config.Value.Slice.FrameInterval)
+}
+
+func makeArgs(ctx *cli.Context, rate string, begin, end util.Timestamp) []string {
+	vf := append([]string{"fps=" + rate}, filters(cropArea(ctx))...)
 	args := []string{
 		"-hide_banner",
+		"-copyts",
+		"-ss", begin.String(),
+		"-to", end.String(),
 		"-i", ctx.String("input"),
-		"-ss", ctx.String("begin"),
-		"-to", ctx.String("end"),
 		"-vf", strings.Join(vf, ","),
+		"-vsync", "passthrough",
 	}
 	args = append(args, config.Value.Ffmpeg.AppendArgs...)
-	args = append(args, path.Join(ctx.String("dir"), "%06d."+config.Value.Slice.Format))
 	return args
 }
 
+type segment struct {
+	begin, end util.Timestamp
+	pattern    string
+	args       []string
+	pts        []util.Timestamp
+	done       bool
+}
+
+func (seg *segment) file(counter int) string {
+	return fmt.Sprintf(seg.pattern, counter+1)
+}
+
+func split(begin, end util.Timestamp, n int) []segment {
+	step := util.Second * util.Timestamp(config.Value.Slice.FrameInterval)
+	length := (end - begin + util.Timestamp(n) - 1) / util.Timestamp(n)
+	length = (length + step - 1) / step * step
+	segments := []segment{}
+	for b := begin; b < end; {
+		e := b - b%step + length
+		if e > end || len(segments) == n-1 {
+			e = end
+		}
+		segments = append(segments, segment{begin: b, end: e})
+		b = e
+	}
+	return segments
+}
+
+func (seg *segment) run(ctx context.Context, first, last bool) {
+	pts := make(chan util.Timestamp, 1024)
+	collected := make(chan []util.Timestamp)
+	go func() {
+		timestamps := []util.Timestamp{}
+		for p := range pts {
+			timestamps = append(timestamps, p)
+		}
+		collected <- timestamps
+	}()
+	seg.done = runFfmpeg(ctx, exec.CommandContext(ctx, "ffmpeg", seg.args...), pts)
+	timestamps := <-collected
+	if !seg.done && len(timestamps) > 0 {
+		// the last reported frame may not have been written completely
+		timestamps = timestamps[:len(timestamps)-1]
+		os.Remove(seg.file(len(timestamps)))
+	}
+	for i, p := range timestamps {
+		// neighbouring segments may both produce the frame on their boundary
+		if (!first && p < seg.begin) || (!last && p >= seg.end) {
+			os.Remove(seg.file(i))
+			timestamps[i] = -1
+		}
+	}
+	seg.pts = timestamps
+}
+
 func Slice(ctx *cli.Context) error {
+	if err := binarize.CheckFormat(config.Value.Slice.Format); err != nil {
+		log.Fatalf("invalid slice.format: %s", err.Error())
+	}
+	concurrency := ctx.Int("concurrency")
+	if concurrency < 1 {
+		return fmt.Errorf("invalid number of segments %d", concurrency)
+	}
 	dir := ctx.String("dir")
 	if err := os.MkdirAll(dir, os.ModeDir|os.FileMode(0755)); err != nil {
 		log.Fatal(err)
 	}
-	begin := ctx.String("begin")
-	beginTime, err := util.ParseDuration(begin)
-	if err != nil {
-		log.Fatalf("unable to parse beginning time: %s", err.Error())
-	}
-	end := ctx.String("end")
-	endTime, err := util.ParseDuration(end)
-	if err != nil {
-		log.Fatalf("unable to parse endding time: %s", err.Error())
-	}
+	beginTime, endTime, probe := resolveRange(ctx)
 
-	progress := make(chan time.Duration, 10)
-	go runFfmpeg(makeArgs(ctx), progress, beginTime, endTime)
-	counter := 0
-	log.Print("performing stream frame renameing")
+	source := make(chan *manifest.Source, 1)
+	go func() {
+		s, err := manifest.NewSource(ctx.String("input"))
+		if err != nil {
+			log.Printf("unable to identify input: %s", err.Error())
+		}
+		source <- s
+	}()
+	segments := split(beginTime, endTime, concurrency)
+	wg := sync.WaitGroup{}
+	for i := range segments {
+		seg := &segments[i]
+		seg.pattern = path.Join(dir, fmt.Sprintf("%02d-%%06d.%s", i, config.Value.Slice.Format))
+		seg.args = append(makeArgs(ctx, Rate(), seg.begin, seg.end), seg.pattern)
+		wg.Add(1)
+		go func(first, last bool) {
+			seg.run(ctx.Context, first, last)
+			wg.Done()
+		}(i == 0, i == len(segments)-1)
+	}
+	wg.Wait()
 
-	t := beginTime
-	for curTime := range progress {
-		for ; t < curTime; t += time.Second * time.Duration(config.Value.Slice.FrameInterval) {
-			pathname := path.Join(dir, fmt.Sprintf("h%02dm%02d", int(t.Hours()), int(t.Minutes())%60))
-			if err := os.MkdirAll(pathname, os.ModeDir|os.FileMode(0755)); err != nil {
+	m := &manifest.Manifest{
+		Source:   <-source,
+		Probe:    probe,
+		Settings: manifest.CurrentSettings(),
+		Crop:     cropArea(ctx),
+		Begin:    beginTime,
+		Frames:   []manifest.Frame{},
+	}
+	t := beginTime - beginTime%util.Second
+	fidB := 0
+	complete := true
+	for _, seg := range segments {
+		m.Args = append(m.Args, seg.args)
+		for counter, p := range seg.pts {
+			if p < 0 {
+				continue
+			}
+			if !complete {
+				os.Remove(seg.file(counter))
+				continue
+			}
+			fid := fidB * config.Value.Slice.FpsFactor
+			newname := util.FramePath(t, fid)
+			if err := os.MkdirAll(path.Dir(path.Join(dir, newname)), os.ModeDir|os.FileMode(0755)); err != nil {
+				log.Fatal(err)
+			}
+			if err := os.Rename(seg.file(counter), path.Join(dir, newname)); err != nil {
 				log.Fatal(err)
 			}
-			for fidB := 0; fidB < config.Value.Slice.Fps; fidB++ {
-				fid := fidB * config.Value.Slice.FpsFactor
-				counter++
-				oldname := path.Join(dir, fmt.Sprintf("%06d.%s", counter, config.Value.Slice.Format))
-				newname := path.Join(pathname, fmt.Sprintf("s%02df%02d.%s", int(t.Seconds())%60, fid, config.Value.Slice.Format))
-				if err := os.Rename(oldname, newname); err != nil {
-					if os.IsNotExist(err) {
-						log.Printf("frame %s/%02d not exist, exitting", util.FormatDuration(t), fid)
-						return nil
-					}
-					log.Fatal(err)
-				}
+			m.Frames = append(m.Frames, manifest.Frame{Name: newname, Time: p})
+			fidB++
+			if fidB == config.Value.Slice.Fps {
+				fidB = 0
+				t += util.Second * util.Timestamp(config.Value.Slice.FrameInterval)
 			}
 		}
+		// frames after an unfinished segment would leave a gap
+		complete = complete && seg.done
+	}
+	log.Printf("ffmpeg produced %d frames in %d segments", len(m.Frames), len(segments))
+	if n := len(m.Frames); n > 0 {
+		m.End = m.Frames[n-1].Time + util.FrameDuration()
+		if m.End > endTime {
+			m.End = endTime
+		}
+	}
+	if err := m.Save(dir); err != nil {
+		log.Fatalf("unable to save manifest: %s", err.Error())
+	}
+	if ctx.Err() != nil {
+		return util.ErrInterrupted
 	}
 	return nil
 }
 
-func runFfmpeg(args []string, progress chan<- time.Duration, beginTime, endTime time.Duration) {
-	cmd := exec.Command("ffmpeg", args...)
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	for i, c := range data {
+		if c == '\n' || c == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func runFfmpeg(ctx context.Context, cmd *exec.Cmd, pts chan<- util.Timestamp) bool {
+	defer close(pts)
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		log.Fatal(err)
 	}
 	stderrBuf := &bytes.Buffer{}
-	tee := io.TeeReader(stderr, stderrBuf)
-	go func(r io.Reader) {
-		s := bufio.NewScanner(r)
-		s.Split(bufio.ScanWords)
-		for s.Scan() {
-			w := s.Text()
-			if strings.HasPrefix(w, "time=") {
-				log.Printf("ffmpeg progress report: %s", w)
-				t, err := util.ParseDuration(w[len("time="):])
-				if err != nil {
-					log.Printf("unrecognized progress timestamp: %q", w)
-				}
-				progress <- t + beginTime
+	log.Printf("starting ffmpeg with %q", cmd.Args[1:])
+	if err := util.Start(cmd); err != nil {
+		log.Fatal(err)
+	}
+	s := bufio.NewScanner(io.TeeReader(stderr, stderrBuf))
+	s.Split(scanLines)
+	for s.Scan() {
+		l := s.Text()
+		if m := showinfoPattern.FindStringSubmatch(l); m != nil {
+			p, err := strconv.ParseFloat(m[2], 64)
+			if err != nil {
+				log.Fatalf("unrecognized frame timestamp: %q", l)
 			}
+			pts <- util.SecondsTimestamp(p)
+		} else if i := strings.Index(l, "time="); i >= 0 {
+			log.Printf("ffmpeg progress report: %s", strings.Fields(l[i:])[0])
+		}
+	}
+	if err := util.Wait(cmd); err != nil {
+		if ctx.Err() != nil {
+			log.Print("ffmpeg stopped due to interruption")
+			return false
 		}
-	}(tee)
-	log.Printf("starting ffmpeg with %q", args)
-	if err := cmd.Run(); err != nil {
 		log.Printf("error occurs while running ffmpeg: %s", err.Error())
 		log.Print("stderr of ffmpeg is shown below:")
 		fmt.Println(string(stderrBuf.Bytes()))
 		os.Exit(1)
 	}
-	progress <- endTime
+	return true
+}
+
+func Stream(ctx *cli.Context, rate string, frames chan<- Frame) {
+	defer close(frames)
+	beginTime, endTime, _ := resolveRange(ctx)
+	args := append(makeArgs(ctx, rate, beginTime, endTime), "-f", "image2pipe", "-c:v", "ppm", "pipe:1")
+	stream(ctx.Context, args, frames)
+}
+
+func Grab(ctx *cli.Context, t util.Timestamp) (Frame, bool) {
+	vf := filters(cropArea(ctx))
+	args := []string{
+		"-hide_banner",
+		"-copyts",
+		"-ss", t.String(),
+		"-i", ctx.String("input"),
+		"-vf", strings.Join(vf, ","),
+		"-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "ppm", "pipe:1",
+	}
+	frames := make(chan Frame, 1)
+	stream(ctx.Context, args, frames)
+	close(frames)
+	f, ok := <-frames
+	return f, ok
+}
+
+func stream(ctx context.Context, args []string, frames chan<- Frame) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	r, w := io.Pipe()
+	defer r.Close()
+	cmd.Stdout = w
+	pts := make(chan util.Timestamp, 1024)
+	go func() {
+		runFfmpeg(ctx, cmd, pts)
+		w.Close()
+	}()
+	br := bufio.NewReaderSize(r, 1<<20)
+	for {
+		img, err := binarize.DecodePNM(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Fatalf("unable to decode frame from ffmpeg: %s", err.Error())
+		}
+		p, ok := <-pts
+		if !ok {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Fatal("missing timestamp of frame from ffmpeg")
+		}
+		select {
+		case frames <- Frame{Image: binarize.Place(img), Time: p}:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+func FrameDuration() Timestamp {
+	return Second * Timestamp(config.Value.Slice.FrameInterval) / Timestamp(config.Value.Slice.Fps)
+}
+
+func FramePath(t Timestamp, fid int) string {
+	return path.Join(
+		fmt.Sprintf("h%02dm%02d", t.Hours(), t.Minutes()),
+		fmt.Sprintf("s%02df%02d.%s", t.Seconds(), fid, config.Value.Slice.Format),
+	)
+}
+
+var framePathRegexp = regexp.MustCompile(`^h(\d{2,})m(\d{2})/s(\d{2})f(\d{2,})\.(\w+)$`)
+
+// ParseFramePath reverses FramePath, returning the second of the frame and
+// its frame number
+func ParseFramePath(name string) (Timestamp, int, bool) {
+	m := framePathRegexp.FindStringSubmatch(name)
+	if m == nil || m[5] != config.Value.Slice.Format {
+		return 0, 0, false
+	}
+	var n [4]int
+	for i := range n {
+		v, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, 0, false
+		}
+		n[i] = v
+	}
+	if n[1] >= 60 || n[2] >= 60 {
+		return 0, 0, false
+	}
+	return Timestamp(n[0])*Hour + Timestamp(n[1])*Minute + Timestamp(n[2])*Second, n[3], true
+}
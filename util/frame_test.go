@@ -0,0 +1,36 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/piggynl/subtitle/config"
+)
+
+func TestParseFramePath(t *testing.T) {
+	config.Value.Slice.Format = "jpg"
+	for _, tt := range []struct {
+		t   Timestamp
+		fid int
+	}{
+		{0, 0},
+		{Hour + 2*Minute + 3*Second, 4},
+		{123*Hour + 59*Minute + 59*Second, 120},
+	} {
+		name := FramePath(tt.t, tt.fid)
+		got, fid, ok := ParseFramePath(name)
+		if !ok || got != tt.t || fid != tt.fid {
+			t.Errorf("ParseFramePath(%q) = %s, %d, %v, want %s, %d", name, got, fid, ok, tt.t, tt.fid)
+		}
+	}
+	for _, name := range []string{
+		"h00m00/s00f00.png",
+		"h00m60/s00f00.jpg",
+		"h00m00/s00f00.jpg.tmp",
+		"h00m00s00f00.jpg",
+		"manifest.json",
+	} {
+		if _, _, ok := ParseFramePath(name); ok {
+			t.Errorf("ParseFramePath(%q) succeeded, want failure", name)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var ErrInterrupted = errors.New("interrupted, partial output has been saved")
+
+func SignalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-ch
+		log.Printf("received %s, stopping child processes and saving partial output (send again to exit immediately)", s)
+		cancel()
+		s = <-ch
+		log.Printf("received %s again, exitting immediately", s)
+		killChildren()
+		os.Exit(130)
+	}()
+	return ctx
+}
+
+var children = struct {
+	sync.Mutex
+	procs   map[*os.Process]struct{}
+	exiting bool
+}{procs: make(map[*os.Process]struct{})}
+
+// Start starts a child process, which is killed if the program exits on a
+// second signal, so it must be waited for with Wait
+func Start(cmd *exec.Cmd) error {
+	children.Lock()
+	defer children.Unlock()
+	if children.exiting {
+		return ErrInterrupted
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	children.procs[cmd.Process] = struct{}{}
+	return nil
+}
+
+func Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	children.Lock()
+	delete(children.procs, cmd.Process)
+	children.Unlock()
+	return err
+}
+
+func Run(cmd *exec.Cmd) error {
+	if err := Start(cmd); err != nil {
+		return err
+	}
+	return Wait(cmd)
+}
+
+func killChildren() {
+	children.Lock()
+	defer children.Unlock()
+	children.exiting = true
+	for p := range children.procs {
+		if err := p.Kill(); err != nil {
+			log.Printf("unable to kill child process %d: %s", p.Pid, err.Error())
+		}
+	}
+}
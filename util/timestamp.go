@@ -0,0 +1,93 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Timestamp int64
+
+const (
+	Millisecond Timestamp = 1
+	Second                = 1000 * Millisecond
+	Minute                = 60 * Second
+	Hour                  = 60 * Minute
+)
+
+func NewTimestamp(d time.Duration) Timestamp {
+	return Timestamp(d / time.Millisecond)
+}
+
+func SecondsTimestamp(s float64) Timestamp {
+	return Timestamp(math.Round(s * 1000))
+}
+
+var timestampRegexp = regexp.MustCompile(`^(\d+):(\d{1,2}):(\d{1,2})(?:\.(\d{1,3}))?$`)
+
+func ParseTimestamp(s string) (Timestamp, error) {
+	m := timestampRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("unable to parse %s: expect hh:mm:ss[.mmm]", s)
+	}
+	hh, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse %s: %w", s, err)
+	}
+	mm, _ := strconv.ParseInt(m[2], 10, 64)
+	ss, _ := strconv.ParseInt(m[3], 10, 64)
+	ms := int64(0)
+	if len(m[4]) > 0 {
+		ms, _ = strconv.ParseInt(m[4]+strings.Repeat("0", 3-len(m[4])), 10, 64)
+	}
+	if mm >= 60 || ss >= 60 || hh > int64(math.MaxInt64/Hour) {
+		return 0, fmt.Errorf("unable to parse %s: field out of range", s)
+	}
+	return Timestamp(hh)*Hour + Timestamp(mm)*Minute + Timestamp(ss)*Second + Timestamp(ms), nil
+}
+
+func (t Timestamp) Duration() time.Duration {
+	return time.Duration(t) * time.Millisecond
+}
+
+func (t Timestamp) Hours() int {
+	return int(t / Hour)
+}
+
+func (t Timestamp) Minutes() int {
+	return int(t/Minute) % 60
+}
+
+func (t Timestamp) Seconds() int {
+	return int(t/Second) % 60
+}
+
+func (t Timestamp) Milliseconds() int {
+	return int(t % Second)
+}
+
+func (t Timestamp) Clock() string {
+	return fmt.Sprintf("%02d:%02d:%02d", t.Hours(), t.Minutes(), t.Seconds())
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%s.%03d", t.Clock(), t.Milliseconds())
+}
+
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var err error
+	*t, err = ParseTimestamp(s)
+	return err
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
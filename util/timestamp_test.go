@@ -0,0 +1,54 @@
+package util
+
+import "testing"
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Timestamp
+		ok    bool
+	}{
+		{"00:00:00", 0, true},
+		{"00:00:01.500", 1500, true},
+		{"00:00:01.5", 1500, true},
+		{"00:00:01.05", 1050, true},
+		{"01:02:03.004", Hour + 2*Minute + 3*Second + 4, true},
+		{"0:1:2", Minute + 2*Second, true},
+		{"100:00:00", 100 * Hour, true},
+		{"00:00:01,500", 0, false},
+		{"00:00:01.1x", 0, false},
+		{"00:00:01.", 0, false},
+		{"00:00:01.1234", 0, false},
+		{"00:00:01 ", 0, false},
+		{" 00:00:01", 0, false},
+		{"00:60:00", 0, false},
+		{"00:00:60", 0, false},
+		{"-1:00:00", 0, false},
+		{"00:00", 0, false},
+		{"00:000:00", 0, false},
+		{"", 0, false},
+		{"99999999999999999999:00:00", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseTimestamp(%q) error = %v, want ok = %v", tt.input, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("ParseTimestamp(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampString(t *testing.T) {
+	for _, s := range []string{"00:00:00.000", "01:02:03.004", "123:59:59.999"} {
+		ts, err := ParseTimestamp(s)
+		if err != nil {
+			t.Fatalf("ParseTimestamp(%q): %s", s, err)
+		}
+		if ts.String() != s {
+			t.Errorf("ParseTimestamp(%q).String() = %q", s, ts.String())
+		}
+	}
+}